@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+func toEthnics(values []string) []mapper.Ethnic {
+	ethnics := make([]mapper.Ethnic, len(values))
+	for i, value := range values {
+		ethnics[i] = mapper.Ethnic(value)
+	}
+	return ethnics
+}
+
+func toEthnicRules(configRules []internal.EthnicRule) []mapper.EthnicRule {
+	rules := make([]mapper.EthnicRule, len(configRules))
+	for i, rule := range configRules {
+		rules[i] = mapper.EthnicRule{
+			EthnicValues: rule.EthnicValue,
+			Nationality1: rule.Nationality1,
+			Nationality2: rule.Nationality2,
+			Ethnic1:      toEthnics(rule.Ethnic1),
+			Ethnic2:      toEthnics(rule.Ethnic2),
+			AnyEthnic:    toEthnics(rule.AnyEthnic),
+			Use:          mapper.Ethnic(rule.Use),
+		}
+	}
+	return rules
+}
+
+func toFallbackPolicies(configPolicies map[string]internal.FallbackPolicy) (map[string]mapper.FallbackPolicy, error) {
+	policies := make(map[string]mapper.FallbackPolicy)
+	policyErrors := []error{}
+
+	for ethnic, configPolicy := range configPolicies {
+		if ethnic != mapper.DefaultFallbackKey && !mapper.IsValidEthnic(ethnic) {
+			policyErrors = append(policyErrors, fmt.Errorf(`fallback for "%s": not a valid ethnic or "%s"`, ethnic, mapper.DefaultFallbackKey))
+			continue
+		}
+
+		policy := mapper.FallbackPolicy{
+			Ethnics: toEthnics(configPolicy.Ethnics),
+			Action:  mapper.FallbackAction(configPolicy.Policy),
+		}
+		if err := mapper.ValidateFallbackPolicy(policy); err != nil {
+			policyErrors = append(policyErrors, fmt.Errorf(`fallback for "%s": %w`, ethnic, err))
+			continue
+		}
+
+		policies[ethnic] = policy
+	}
+
+	return policies, errors.Join(policyErrors...)
+}
+
+func toImageLayers(configLayers []internal.ImageLayer) []mapper.ImageRoot {
+	layers := make([]mapper.ImageRoot, len(configLayers))
+	for i, layer := range configLayers {
+		layers[i] = mapper.ImageRoot{Path: layer.Path, Priority: internal.DefaultLayerPriority}
+		if layer.Priority != nil {
+			layers[i].Priority = *layer.Priority
+		}
+	}
+	return layers
+}
+
+var (
+	seedFromConfig  bool
+	imageInclude    []string
+	imageExclude    []string
+	imageExtensions = internal.DefaultImageExtensions
+	imageLayers     []mapper.ImageRoot
+	gameDate        time.Time // zero for today
+)
+
+// loadConfig reads the config file if there is one, and uses its options for
+// every flag that was not set on the command line
+func loadConfig(cmd *cobra.Command) internal.JaqenConfig {
+	configFromFile, err := readConfig(cmd)
+	if err != nil {
+		fail(failConfig, err)
+	}
+	return configFromFile
+}
+
+// readConfig is loadConfig without stopping the command on errors
+func readConfig(cmd *cobra.Command) (internal.JaqenConfig, error) {
+	var configFromFile internal.JaqenConfig
+
+	for _, layerFlag := range layerFlags {
+		layer, err := parseImageLayer(layerFlag)
+		if err != nil {
+			return configFromFile, err
+		}
+		imageLayers = append(imageLayers, layer)
+	}
+
+	if gameDateValue != "" {
+		date, err := mapper.ParseDate(gameDateValue)
+		if err != nil {
+			return configFromFile, fmt.Errorf("--%s: %w", flagkeyGameDate, err)
+		}
+		gameDate = date
+	}
+
+	if _, err := os.Stat(configPath); err != nil {
+		return configFromFile, nil
+	}
+
+	configFromFile, err := internal.ReadConfig(configPath)
+	if err != nil {
+		return configFromFile, err
+	}
+
+	if !cmd.Flags().Changed(flagkeysPreserve) && configFromFile.Preserve != nil {
+		preserve = *configFromFile.Preserve
+	}
+	if !cmd.Flags().Changed(flagkeysImg) && configFromFile.IMGPath != nil {
+		imgDir = *configFromFile.IMGPath
+	}
+	if !cmd.Flags().Changed(flagkeysXml) && configFromFile.XMLPath != nil {
+		xmlPath = *configFromFile.XMLPath
+	}
+	if !cmd.Flags().Changed(flagkeysRtf) && configFromFile.RTFPath != nil {
+		rtfPath = *configFromFile.RTFPath
+	}
+	if !cmd.Flags().Changed(flagkeyStaffRtf) && configFromFile.StaffRTFPath != nil {
+		staffRTFPath = *configFromFile.StaffRTFPath
+	}
+	if !cmd.Flags().Changed(flagkeyFmVersion) && configFromFile.FMVersion != nil {
+		fmVersion = *configFromFile.FMVersion
+	}
+	if !cmd.Flags().Changed(flagkeyDuplicate) && configFromFile.AllowDuplicate != nil {
+		allowDuplicate = *configFromFile.AllowDuplicate
+	}
+	if !cmd.Flags().Changed(flagkeyBackups) && configFromFile.BackupCount != nil {
+		backupCount = *configFromFile.BackupCount
+	}
+	if !cmd.Flags().Changed(flagkeySeed) && configFromFile.Seed != nil {
+		seed = *configFromFile.Seed
+		seedFromConfig = true
+	}
+	if !cmd.Flags().Changed(flagkeyStable) && configFromFile.StableHash != nil {
+		stableHash = *configFromFile.StableHash
+	}
+	if !cmd.Flags().Changed(flagkeyBalanced) && configFromFile.Balanced != nil {
+		balanced = *configFromFile.Balanced
+	}
+	if !cmd.Flags().Changed(flagkeyRecursive) && configFromFile.Recursive != nil {
+		recursive = *configFromFile.Recursive
+	}
+	if !cmd.Flags().Changed(flagkeyUnknown) && configFromFile.UnknownNation != nil {
+		unknownNation = *configFromFile.UnknownNation
+	}
+	if !cmd.Flags().Changed(flagkeyDefEthnic) && configFromFile.DefaultEthnic != nil {
+		defaultEthnic = *configFromFile.DefaultEthnic
+	}
+	if !cmd.Flags().Changed(flagkeyGameDate) && configFromFile.GameDate != nil {
+		date, err := mapper.ParseDate(*configFromFile.GameDate)
+		if err != nil {
+			return configFromFile, fmt.Errorf("game_date: %w", err)
+		}
+		gameDate = date
+	}
+	if !cmd.Flags().Changed(flagkeyDedupe) && configFromFile.Dedupe != nil {
+		dedupe = *configFromFile.Dedupe
+	}
+	if !cmd.Flags().Changed(flagkeyLayer) {
+		imageLayers = toImageLayers(configFromFile.ImageLayers)
+	}
+	if configFromFile.ImageInclude != nil {
+		imageInclude = *configFromFile.ImageInclude
+	}
+	if configFromFile.ImageExclude != nil {
+		imageExclude = *configFromFile.ImageExclude
+	}
+	if configFromFile.ImageExtensions != nil {
+		imageExtensions = *configFromFile.ImageExtensions
+	}
+	if !cmd.Flags().Changed(flagkeyValidate) && configFromFile.ImageValidation != nil {
+		imageValidation = *configFromFile.ImageValidation
+	}
+
+	return configFromFile, nil
+}
+
+// applyMapperConfig applies the config options that change how players are
+// mapped to ethnics
+func applyMapperConfig(configFromFile internal.JaqenConfig) {
+	if err := setMapperConfig(configFromFile); err != nil {
+		fail(failConfig, err)
+	}
+}
+
+func setMapperConfig(configFromFile internal.JaqenConfig) error {
+	if configFromFile.Ethnicities != nil {
+		if err := mapper.AddEthnicities(*configFromFile.Ethnicities); err != nil {
+			return err
+		}
+	}
+
+	if configFromFile.MappingOverride != nil {
+		if err := mapper.OverrideNationEthnicMapping(*configFromFile.MappingOverride); err != nil {
+			return err
+		}
+	}
+
+	if configFromFile.EthnicRules != nil {
+		if err := mapper.SetEthnicRules(toEthnicRules(configFromFile.EthnicRules)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func readOptions(role mapper.Role) mapper.ReadOptions {
+	return mapper.ReadOptions{
+		UnknownNationality: mapper.UnknownNationalityPolicy(unknownNation),
+		DefaultEthnic:      mapper.Ethnic(defaultEthnic),
+		Role:               role,
+		Date:               gameDate,
+	}
+}
+
+func imagePoolOptions() mapper.ImagePoolOptions {
+	return mapper.ImagePoolOptions{
+		Recursive:  recursive,
+		Include:    imageInclude,
+		Exclude:    imageExclude,
+		Extensions: imageExtensions,
+		Validation: mapper.ImageValidation(imageValidation),
+	}
+}
+
+// configureImagePool applies the options that change how images are picked
+func configureImagePool(cmd *cobra.Command, imagePool *mapper.ImagePool) {
+	if cmd.Flags().Changed(flagkeySeed) || seedFromConfig {
+		imagePool.Seed(seed)
+	}
+	imagePool.UseStableHash(stableHash)
+	imagePool.UseBalanced(balanced)
+
+	if dedupe {
+		cache, err := mapper.ReadDedupeCache(imgDir)
+		if err != nil {
+			fail(failConfig, err)
+		}
+		if cache == nil {
+			warn("missing_dedupe_results", "no dedupe results found, run jaqen dedupe first")
+			return
+		}
+		imagePool.UseDuplicateClusters(cache.Clusters)
+	}
+}
@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+var dedupeThreshold int
+
+const flagkeyThreshold = "threshold"
+
+type dedupeResult struct {
+	Checked    int                       `json:"checked"`
+	Duplicates int                       `json:"duplicates"`
+	Clusters   []mapper.DuplicateCluster `json:"clusters"`
+}
+
+func dedupeImages(cmd *cobra.Command, _ []string) {
+	applyMapperConfig(loadConfig(cmd))
+
+	roots, err := imageRoots()
+	if err != nil {
+		fail(failConfig, err)
+	}
+	for _, root := range roots {
+		if _, err := os.Stat(root.Path); err != nil {
+			fail(failConfig, fmt.Errorf("image directory could not be found: %w", err))
+		}
+	}
+
+	imagePool, err := mapper.NewLayeredImagePool(roots, imagePoolOptions())
+	if err != nil {
+		fail(failConfig, err)
+	}
+
+	previous, err := mapper.ReadDedupeCache(imgDir)
+	if err != nil {
+		warn("dedupe_results", "%s", err)
+	}
+
+	// unreadable images are reported but don't stop the others from being compared
+	hashes, err := imagePool.HashImages(previous)
+	if err != nil {
+		warn("unreadable_images", "%s", err)
+	}
+
+	clusters := mapper.FindDuplicates(hashes, dedupeThreshold)
+
+	duplicates := 0
+	for _, cluster := range clusters {
+		duplicates += len(cluster.Images) - 1
+	}
+	result.Data = dedupeResult{Checked: len(hashes), Duplicates: duplicates, Clusters: clusters}
+
+	if !jsonOutput() {
+		for _, cluster := range clusters {
+			kind := "near duplicates"
+			if cluster.Exact {
+				kind = "exact duplicates"
+			}
+
+			fmt.Printf("%s:\n", kind)
+			for _, image := range cluster.Images {
+				fmt.Printf("  %s\n", image)
+			}
+		}
+		fmt.Printf("%d images checked, %d clusters, %d duplicate images\n", len(hashes), len(clusters), duplicates)
+	}
+
+	cache := &mapper.DedupeCache{
+		Threshold: dedupeThreshold,
+		Hashes:    hashes,
+		Clusters:  clusters,
+	}
+	if err := mapper.WriteDedupeCache(imgDir, cache); err != nil {
+		fail(failWrite, err)
+	}
+
+	printResult()
+}
+
+var dedupeCmd = &cobra.Command{
+	Use:   "dedupe",
+	Short: "Finds images that show the same face",
+	Long:  "Hashes every image of the facepack and reports the images that are exact or near duplicates of each other, across ethnic folders. The results are saved in the image directory, so that --dedupe can treat each cluster as one image.",
+	Args:  cobra.NoArgs,
+	Run:   dedupeImages,
+}
+
+func init() {
+	dedupeCmd.Flags().IntVar(&dedupeThreshold, flagkeyThreshold, internal.DefaultDedupeThreshold, "Number of the 64 perceptual hash bits two images may differ in to be near duplicates")
+	rootCmd.AddCommand(dedupeCmd)
+}
@@ -0,0 +1,355 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+type checkStatus string
+
+const (
+	checkPass checkStatus = "pass"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+)
+
+type doctorCheck struct {
+	Check   string      `json:"check"`
+	Status  checkStatus `json:"status"`
+	Message string      `json:"message"`
+	Fix     string      `json:"fix,omitempty"`
+}
+
+type doctorResult struct {
+	Checks []doctorCheck `json:"checks"`
+	Passed int           `json:"passed"`
+	Warned int           `json:"warned"`
+	Failed int           `json:"failed"`
+}
+
+// number of people of the RTF file shown as examples
+const doctorSampleSize = 3
+
+type doctor struct {
+	doctorResult
+}
+
+func (d *doctor) add(check string, status checkStatus, message string, fix string) {
+	// errors of the mapper span several lines
+	message = strings.Join(strings.Fields(message), " ")
+
+	d.Checks = append(d.Checks, doctorCheck{Check: check, Status: status, Message: message, Fix: fix})
+	switch status {
+	case checkPass:
+		d.Passed++
+	case checkWarn:
+		d.Warned++
+	case checkFail:
+		d.Failed++
+	}
+}
+
+func (d *doctor) pass(check string, message string) {
+	d.add(check, checkPass, message, "")
+}
+
+func (d *doctor) warn(check string, message string, fix string) {
+	d.add(check, checkWarn, message, fix)
+}
+
+func (d *doctor) fail(check string, message string, fix string) {
+	d.add(check, checkFail, message, fix)
+}
+
+func (d *doctor) print() {
+	for _, check := range d.Checks {
+		fmt.Printf("%-4s  %-14s %s\n", strings.ToUpper(string(check.Status)), check.Check, check.Message)
+		if check.Fix != "" {
+			fmt.Printf("%-4s  %-14s fix: %s\n", "", "", check.Fix)
+		}
+	}
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n", d.Passed, d.Warned, d.Failed)
+}
+
+// checkConfig reads the config file the way every command does
+func (d *doctor) checkConfig(cmd *cobra.Command) {
+	configFromFile, err := readConfig(cmd)
+	if err != nil {
+		d.fail("config", fmt.Sprintf("cannot read %s: %s", configPath, err), "fix the toml syntax of the config file, or pass another one with --"+flagkeyConfig)
+		return
+	}
+
+	if err := setMapperConfig(configFromFile); err != nil {
+		d.fail("config", fmt.Sprintf("invalid options in %s: %s", configPath, err), "fix the ethnicities, [mapping_override] or [[ethnic_rule]] entries it names")
+		return
+	}
+
+	if _, err := os.Stat(configPath); err != nil {
+		d.pass("config", fmt.Sprintf("no config file at %s, using the flags and defaults", configPath))
+		return
+	}
+	d.pass("config", fmt.Sprintf("%s is valid", configPath))
+}
+
+func (d *doctor) checkVersion() bool {
+	if _, err := mapper.LookupFMVersion(fmVersion); err != nil {
+		d.fail("version", err.Error(), fmt.Sprintf("pass --%s with the year of your game, ex: %s", flagkeyFmVersion, internal.DefaultFMVersion))
+		return false
+	}
+	d.pass("version", fmt.Sprintf("football manager %s", fmVersion))
+	return true
+}
+
+// checkXML reads the xml file and the booleans the game relies on to show
+// new faces without a restart
+func (d *doctor) checkXML(versionOK bool) *mapper.Mapping {
+	info, err := os.Stat(xmlPath)
+	if err != nil {
+		d.fail("xml path", fmt.Sprintf("%s could not be found", xmlPath), fmt.Sprintf("pass --%s with the config.xml of the folder that holds your faces, ex: .../graphics/faces/config.xml", flagkeysXml))
+		return nil
+	}
+	if info.IsDir() {
+		d.fail("xml path", fmt.Sprintf("%s is a directory", xmlPath), fmt.Sprintf("pass --%s with the path of the config.xml file inside of it", flagkeysXml))
+		return nil
+	}
+	if filepath.Base(xmlPath) != "config.xml" {
+		d.warn("xml path", fmt.Sprintf("%s is not named config.xml", xmlPath), "the game only reads files named config.xml, rename it or point to the right file")
+	} else {
+		d.pass("xml path", xmlPath)
+	}
+
+	if !versionOK {
+		return nil
+	}
+
+	mapping, err := mapper.NewMapping(xmlPath, fmVersion)
+	if err != nil {
+		d.fail("xml", fmt.Sprintf("%s cannot be read: %s", xmlPath, err), "restore a backup with jaqen restore, or start over from the config.xml of the facepack")
+		return nil
+	}
+	d.pass("xml", fmt.Sprintf("%s is valid, %d faces mapped", xmlPath, len(mapping.Images())))
+
+	version, _ := mapper.LookupFMVersion(fmVersion)
+	portraits := 0
+	for _, record := range mapping.UnmanagedRecords() {
+		if version.ClassifyRecord(record) == mapper.RecordPortrait {
+			portraits++
+		}
+	}
+	if portraits > 0 {
+		d.warn("xml", fmt.Sprintf("%d portrait record(s) do not match the ids of version %s", portraits, fmVersion), fmt.Sprintf("check --%s, those records are left as they are", flagkeyFmVersion))
+	}
+
+	missing := make([]string, 0)
+	for _, boolean := range mapper.XMLBooleans {
+		if _, ok := mapping.Boolean(boolean.ID); !ok {
+			missing = append(missing, boolean.ID)
+		}
+	}
+	if len(missing) > 0 {
+		d.warn("xml", fmt.Sprintf("missing booleans: %s", strings.Join(missing, ", ")), "add them to config.xml, jaqen leaves them as they are")
+	}
+
+	if preload, ok := mapping.Boolean("preload"); ok && preload != "false" {
+		d.warn("cache", fmt.Sprintf(`preload is "%s", the game keeps showing cached faces`, preload), `set preload to false in config.xml, then in the game's preferences untick "Use caching to decrease page loading times" and tick "Reload skin when confirming changes"`)
+	} else {
+		d.pass("cache", `preload is off, confirm the preferences with "Reload skin when confirming changes" ticked to see new faces`)
+	}
+
+	return mapping
+}
+
+func (d *doctor) checkRTF(check string, filePath string, role mapper.Role) {
+	if _, err := os.Stat(filePath); err != nil {
+		d.fail(check+" path", fmt.Sprintf("%s could not be found", filePath), "export the search view with Ctrl+P as a Text File, and pass the path of the .rtf file")
+		return
+	}
+	d.pass(check+" path", filePath)
+
+	people, unknowns, err := mapper.ReadPeople(filePath, readOptions(role))
+	if errors.Is(err, mapper.ErrUnknownNationality) && len(unknowns) > 0 {
+		d.warn(check, fmt.Sprintf("%d nationality code(s) have no ethnic, ex: %s", len(unknowns), unknowns[0]), fmt.Sprintf("add them to [mapping_override] in the config file, run with --%s to add them commented out, or use --%s", flagkeySuggest, flagkeyUnknown))
+		people, _, err = mapper.ReadPeople(filePath, mapper.ReadOptions{UnknownNationality: mapper.UnknownNationalitySkip, Role: role})
+	}
+	if err != nil {
+		fix := "export it from the view in views/PlayerSearch.fmf, it needs the UID, Nat, 2nd Nat and Ethnicity columns"
+		if role == mapper.RoleStaff {
+			fix = "export it from a staff search view set up as in views/StaffSearch.md, it needs the UID, Nat, 2nd Nat, Ethnicity and Job columns"
+		}
+		d.fail(check, fmt.Sprintf("%s cannot be read: %s", filePath, err), fix)
+		return
+	}
+
+	if len(people) == 0 {
+		d.warn(check, fmt.Sprintf("%s has no rows", filePath), "select every row of the search with Ctrl+A before printing it to a file")
+		return
+	}
+
+	sample := make([]string, 0, doctorSampleSize)
+	for _, person := range people[:min(len(people), doctorSampleSize)] {
+		sample = append(sample, fmt.Sprintf("%s %s", person.ID, person.Ethnic))
+	}
+	d.pass(check, fmt.Sprintf("%d %s(s), ex: %s", len(people), role, strings.Join(sample, ", ")))
+}
+
+// checkImages looks for the ethnic folders in every image directory and
+// counts their images
+func (d *doctor) checkImages() {
+	roots, err := imageRoots()
+	if err != nil {
+		d.fail("img path", err.Error(), fmt.Sprintf("check the --%s and --%s paths", flagkeysImg, flagkeyLayer))
+		return
+	}
+
+	for _, root := range roots {
+		info, err := os.Stat(root.Path)
+		if err != nil || !info.IsDir() {
+			d.fail("img path", fmt.Sprintf("%s is not a directory", root.Path), fmt.Sprintf("pass --%s with the folder that holds the ethnic folders, ex: African, Asian", flagkeysImg))
+			return
+		}
+
+		if hasEthnicFolder(root.Path) {
+			d.pass("img path", root.Path)
+			continue
+		}
+
+		fix := fmt.Sprintf("pass --%s with the folder that holds the ethnic folders, ex: African, Asian", flagkeysImg)
+		if nested := nestedImageRoot(root.Path); nested != "" {
+			fix = fmt.Sprintf("the ethnic folders are in %s, pass --%s=%s", nested, flagkeysImg, nested)
+		}
+		d.fail("img path", fmt.Sprintf("%s has none of the ethnic folders", root.Path), fix)
+		return
+	}
+
+	imagePool, err := mapper.NewLayeredImagePool(roots, imagePoolOptions())
+	if err != nil {
+		d.fail("images", err.Error(), "check the image options of the config file and the permissions of the image directories")
+		return
+	}
+
+	for _, ethnic := range mapper.Ethnicities {
+		switch {
+		case !imagePool.HasEthnic(ethnic):
+			d.warn("images", fmt.Sprintf("%s has no folder", ethnic), fmt.Sprintf("add a %s folder, or a [fallback] for it in the config file if the facepack has none", ethnic))
+		case imagePool.Total(ethnic) == 0:
+			d.warn("images", fmt.Sprintf("%s folder has no images", ethnic), fmt.Sprintf("add images, check --%s and the image_extensions option, or use --%s for images in subfolders", flagkeyValidate, flagkeyRecursive))
+		default:
+			d.pass("images", fmt.Sprintf("%s: %d images", ethnic, imagePool.Total(ethnic)))
+		}
+	}
+
+	if invalidImages := imagePool.InvalidImages(); len(invalidImages) > 0 {
+		d.warn("images", fmt.Sprintf("%d image file(s) are left out of the pool", len(invalidImages)), "run jaqen stats to list them with the reason")
+	}
+
+}
+
+func hasEthnicFolder(directory string) bool {
+	for _, ethnic := range mapper.Ethnicities {
+		if info, err := os.Stat(filepath.Join(directory, string(ethnic))); err == nil && info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// nestedImageRoot finds the ethnic folders one level down, the usual mistake
+// being to point at the folder the facepack was extracted to
+func nestedImageRoot(directory string) string {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return ""
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() && hasEthnicFolder(filepath.Join(directory, entry.Name())) {
+			return filepath.Join(directory, entry.Name())
+		}
+	}
+	return ""
+}
+
+// checkFromPaths resolves the image paths of the xml file the way the game
+// does, relative to the folder of the xml file
+func (d *doctor) checkFromPaths(mapping *mapper.Mapping) {
+	images := mapping.Images()
+	if len(images) == 0 {
+		return
+	}
+
+	missing := 0
+	example := ""
+	imageFiles := mapper.NewImageFiles()
+	for _, imagePath := range images {
+		if !imageFiles.Exists(resolveImagePath(imagePath, xmlPath)) {
+			if missing == 0 || string(imagePath) < example {
+				example = string(imagePath)
+			}
+			missing++
+		}
+	}
+
+	switch {
+	case missing == 0:
+		d.pass("from paths", fmt.Sprintf("the %d mapped images exist", len(images)))
+	case missing == len(images):
+		d.fail("from paths", fmt.Sprintf("none of the %d mapped images exist, ex: %s", len(images), example), "image paths are relative to the folder of config.xml, keep config.xml where the facepack put it and rerun jaqen without --preserve")
+	default:
+		d.warn("from paths", fmt.Sprintf("%d of %d mapped images do not exist, ex: %s", missing, len(images), example), "run jaqen prune --reassign to give those people a new image, or jaqen prune --remove")
+	}
+}
+
+func runDoctor(cmd *cobra.Command, _ []string) {
+	d := &doctor{doctorResult: doctorResult{Checks: []doctorCheck{}}}
+
+	d.checkConfig(cmd)
+	versionOK := d.checkVersion()
+	mapping := d.checkXML(versionOK)
+
+	if err := mapper.ValidateReadOptions(readOptions(mapper.RolePlayer)); err != nil {
+		d.fail("rtf", err.Error(), fmt.Sprintf("check --%s and --%s", flagkeyUnknown, flagkeyDefEthnic))
+	} else {
+		d.checkRTF("rtf", rtfPath, mapper.RolePlayer)
+		if staffRTFPath != "" {
+			d.checkRTF("staff rtf", staffRTFPath, mapper.RoleStaff)
+		}
+	}
+
+	d.checkImages()
+	if mapping != nil {
+		d.checkFromPaths(mapping)
+	}
+
+	result.Data = d.doctorResult
+	if !jsonOutput() {
+		d.print()
+	}
+
+	if d.Failed > 0 {
+		result.OK = false
+		result.ExitCode = exitFailure
+		printResult()
+		os.Exit(exitFailure)
+	}
+	printResult()
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Checks the paths, files and facepack jaqen would use",
+	Long:  "Checks the config file, the xml file, the rtf file, the ethnic folders of the image directories and the image paths of the xml file, and prints what to fix for every problem found.",
+	Args:  cobra.NoArgs,
+	Run:   runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
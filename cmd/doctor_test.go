@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// failedChecks runs jaqen doctor in dir and returns the checks that failed
+func failedChecks(t *testing.T, dir string, args ...string) []string {
+	t.Helper()
+
+	output, run := jsonResult(t, dir, append([]string{"doctor", "--img=faces"}, args...)...)
+	var report doctorResult
+	decodeData(t, output, &report)
+
+	failed := make([]string, 0)
+	for _, check := range report.Checks {
+		if check.Status == checkFail {
+			failed = append(failed, check.Check)
+		}
+	}
+	expected := 0
+	if len(failed) > 0 {
+		expected = exitFailure
+	}
+	if run.exitCode != expected || report.Failed != len(failed) {
+		t.Fatalf("expected exit code %d for %d failed check(s), got %d: %s", expected, len(failed), run.exitCode, run.stdout)
+	}
+	return failed
+}
+
+func TestDoctor_ReportsEachFailedCheck(t *testing.T) {
+	cases := []struct {
+		check string
+		setup func(t *testing.T, dir string)
+		args  []string
+	}{
+		{check: "config", setup: func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "jaqen.toml"), []byte("preserve = [\n"))
+		}},
+		{check: "version", args: []string{"--version=1999"}},
+		{check: "xml path", args: []string{"--xml=missing.xml"}},
+		{check: "xml", setup: func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "config.xml"), []byte("<config></config>"))
+		}},
+		{check: "rtf path", args: []string{"--rtf=missing.rtf"}},
+		{check: "rtf", setup: func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "newgen.rtf"), []byte("| UID | Nat | 2nd Nat |\r\n| 1 | NGA |  |\r\n"))
+		}},
+		{check: "staff rtf path", args: []string{"--staff_rtf=missing.rtf"}},
+		{check: "img path", setup: func(t *testing.T, dir string) {
+			if err := os.Rename(filepath.Join(dir, "faces", "African"), filepath.Join(dir, "faces", "Unknown")); err != nil {
+				t.Fatalf("could not rename folder: %v", err)
+			}
+		}},
+		{check: "from paths", setup: func(t *testing.T, dir string) {
+			writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(testConfigXML("1", "faces/African/missing")))
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.check, func(t *testing.T) {
+			dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n", "African/a.png")
+			if failed := failedChecks(t, dir); len(failed) != 0 {
+				t.Fatalf("expected a healthy facepack to pass, got failed checks %v", failed)
+			}
+
+			if c.setup != nil {
+				c.setup(t, dir)
+			}
+			if failed := failedChecks(t, dir, c.args...); !slices.Equal(failed, []string{c.check}) {
+				t.Fatalf("expected only the %s check to fail, got %v", c.check, failed)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"errors"
-	"log"
 	"os"
 	"sort"
 
@@ -18,12 +17,12 @@ func formatConfig(cmd *cobra.Command, args []string) {
 	}
 
 	if _, err := os.Stat(configPath); err != nil {
-		log.Fatalln(errors.New("config file not found"))
+		fail(failConfig, errors.New("config file not found"))
 	}
 
 	config, err := internal.ReadConfig(configPath)
 	if err != nil {
-		log.Fatalln(err)
+		fail(failConfig, err)
 	}
 
 	if config.MappingOverride != nil {
@@ -41,8 +40,10 @@ func formatConfig(cmd *cobra.Command, args []string) {
 	}
 
 	if err = internal.WriteConfig(config, configPath); err != nil {
-		log.Fatalln(err)
+		fail(failWrite, err)
 	}
+
+	printResult()
 }
 
 var formatCmd = &cobra.Command{
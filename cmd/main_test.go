@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// commands are run in a child process, as they keep their options in package
+// variables and stop with os.Exit
+const testArgsEnv = "JAQEN_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if argsJSON := os.Getenv(testArgsEnv); argsJSON != "" {
+		var args []string
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			panic(err)
+		}
+		rootCmd.SetArgs(args)
+		Execute()
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+type jaqenRun struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// runJaqen runs jaqen with the given arguments in dir
+func runJaqen(t *testing.T, dir string, args ...string) jaqenRun {
+	t.Helper()
+
+	argsJSON, err := json.Marshal(args)
+	if err != nil {
+		t.Fatalf("could not encode arguments: %v", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(os.Args[0], "-test.run=^$")
+	command.Dir = dir
+	command.Env = append(os.Environ(), testArgsEnv+"="+string(argsJSON))
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	run := jaqenRun{}
+	var exitErr *exec.ExitError
+	if err := command.Run(); errors.As(err, &exitErr) {
+		run.exitCode = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("could not run jaqen: %v", err)
+	}
+	run.stdout, run.stderr = stdout.String(), stderr.String()
+	return run
+}
+
+// jsonResult runs jaqen with --output=json and decodes its result
+func jsonResult(t *testing.T, dir string, args ...string) (commandResult, jaqenRun) {
+	t.Helper()
+
+	run := runJaqen(t, dir, append(args, "--"+flagkeyOutput+"=json")...)
+	var decoded commandResult
+	if err := json.Unmarshal([]byte(run.stdout), &decoded); err != nil {
+		t.Fatalf("could not decode json output %q: %v, stderr: %s", run.stdout, err, run.stderr)
+	}
+	return decoded, run
+}
+
+// decodeData decodes the data of a json result, which is only typed by the
+// command that printed it
+func decodeData(t *testing.T, output commandResult, data any) {
+	t.Helper()
+
+	dataJSON, err := json.Marshal(output.Data)
+	if err != nil {
+		t.Fatalf("could not encode data: %v", err)
+	}
+	if err := json.Unmarshal(dataJSON, data); err != nil {
+		t.Fatalf("could not decode data %s: %v", dataJSON, err)
+	}
+}
+
+func writeTestFile(t *testing.T, filePath string, content []byte) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		t.Fatalf("could not create folder: %v", err)
+	}
+	if err := os.WriteFile(filePath, content, 0o644); err != nil {
+		t.Fatalf("could not write file: %v", err)
+	}
+}
+
+func readTestFile(t *testing.T, filePath string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	return string(content)
+}
+
+// writeTestImages writes small png images, every one of them different
+func writeTestImages(t *testing.T, root string, relativePaths ...string) {
+	t.Helper()
+
+	for i, relativePath := range relativePaths {
+		img := image.NewGray(image.Rect(0, 0, 8, 8))
+		img.SetGray(i%8, i/8%8, color.Gray{Y: 255})
+
+		var buffer bytes.Buffer
+		if err := png.Encode(&buffer, img); err != nil {
+			t.Fatalf("could not encode image: %v", err)
+		}
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(relativePath)), buffer.Bytes())
+	}
+}
+
+// testConfigXML is a config.xml that maps the given 2024 player ids to images,
+// ex: "1", "faces/African/a"
+func testConfigXML(mappings ...string) string {
+	records := ""
+	for i := 0; i+1 < len(mappings); i += 2 {
+		records += fmt.Sprintf("\t\t<record from=\"%s\" to=\"graphics/pictures/person/r-%s/portrait\"/>\n", mappings[i+1], mappings[i])
+	}
+	return "<record>\n\t<boolean id=\"preload\" value=\"false\"/>\n\t<boolean id=\"amap\" value=\"false\"/>\n\t<list id=\"maps\">\n" + records + "\t</list>\n</record>\n"
+}
+
+// newTestFacepack writes config.xml, newgen.rtf with the given rows and the
+// images in faces, ex: African/a.png, to a new folder
+func newTestFacepack(t *testing.T, rtfRows string, images ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(testConfigXML()))
+	writeTestFile(t, filepath.Join(dir, "newgen.rtf"), []byte("| UID | Nat | 2nd Nat | Ethnicity |\r\n"+rtfRows))
+	writeTestImages(t, filepath.Join(dir, "faces"), images...)
+	return dir
+}
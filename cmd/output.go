@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// exit codes of a failed run, so that scripts can tell failures apart
+const (
+	exitFailure   = 1 // anything that has no class of its own
+	exitConfig    = 2 // the config file, flags or input paths are wrong
+	exitRTF       = 3 // the rtf file cannot be parsed
+	exitExhausted = 4 // an ethnic ran out of images
+	exitWrite     = 5 // the xml file or its backup cannot be written
+)
+
+type failureClass struct {
+	Code string
+	Exit int
+}
+
+var (
+	failGeneric   = failureClass{"error", exitFailure}
+	failConfig    = failureClass{"config", exitConfig}
+	failXML       = failureClass{"xml", exitFailure}
+	failRTF       = failureClass{"rtf_parse", exitRTF}
+	failExhausted = failureClass{"pool_exhausted", exitExhausted}
+	failWrite     = failureClass{"write", exitWrite}
+)
+
+type outputMessage struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ethnicResult struct {
+	Ethnic     mapper.Ethnic `json:"ethnic"`
+	New        int           `json:"new"`
+	Preserved  int           `json:"preserved"`
+	Reassigned int           `json:"reassigned"`
+	Pinned     int           `json:"pinned"`
+	Skipped    int           `json:"skipped"`
+}
+
+type assignedPlayer struct {
+	ID       mapper.PlayerID `json:"uid"`
+	Ethnic   mapper.Ethnic   `json:"ethnic"`
+	Role     mapper.Role     `json:"role"`
+	Age      int             `json:"age,omitempty"`
+	Image    mapper.FilePath `json:"image"`
+	Status   assignmentKind  `json:"status"`
+	Fallback string          `json:"fallback,omitempty"`
+}
+
+// commandResult is printed by --output=json once a command is done, whether
+// it succeeded or not
+type commandResult struct {
+	Command       string                         `json:"command"`
+	OK            bool                           `json:"ok"`
+	ExitCode      int                            `json:"exit_code"`
+	DryRun        bool                           `json:"dry_run,omitempty"`
+	Ethnicities   []ethnicResult                 `json:"ethnicities,omitempty"`
+	Assigned      []assignedPlayer               `json:"assigned,omitempty"`
+	Preserved     int                            `json:"preserved"`
+	OverrideStubs []internal.MappingOverrideStub `json:"override_stubs,omitempty"` // entries a dry run with --suggest_overrides would add
+	Data          any                            `json:"data,omitempty"`           // results of the other commands
+	Warnings      []outputMessage                `json:"warnings"`
+	Errors        []outputMessage                `json:"errors"`
+}
+
+var result = &commandResult{
+	OK:       true,
+	Warnings: []outputMessage{},
+	Errors:   []outputMessage{},
+}
+
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+func validateOutput() {
+	if outputFormat != outputText && outputFormat != outputJSON {
+		format := outputFormat
+		outputFormat = outputText
+		fail(failConfig, fmt.Errorf(`output "%s" is not one of %s or %s`, format, outputText, outputJSON))
+	}
+}
+
+// warn logs a warning, or keeps it for the json result
+func warn(code string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	if jsonOutput() {
+		result.Warnings = append(result.Warnings, outputMessage{Code: code, Message: message})
+		return
+	}
+	log.Println(message)
+}
+
+// fail stops the command with the exit code of its failure class
+func fail(class failureClass, err error) {
+	if !jsonOutput() {
+		log.Println(err)
+		os.Exit(class.Exit)
+	}
+
+	result.OK = false
+	result.ExitCode = class.Exit
+	result.Errors = append(result.Errors, outputMessage{Code: class.Code, Message: err.Error()})
+	printResult()
+	os.Exit(class.Exit)
+}
+
+// failOnImages fails with pool_exhausted when the pool ran out of images
+func failOnImages(err error) {
+	if errors.Is(err, mapper.ErrOutOfImages) {
+		fail(failExhausted, err)
+	}
+	fail(failGeneric, err)
+}
+
+// printResult prints the json result, it does nothing for text output
+func printResult() {
+	if !jsonOutput() {
+		return
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil {
+		log.Println(err)
+		os.Exit(exitFailure)
+	}
+}
+
+// setResult fills the json result with the assignments of a mapping run
+func (s *runSummary) setResult() {
+	counts, ethnics := s.countsPerEthnic()
+	for _, ethnic := range ethnics {
+		result.Ethnicities = append(result.Ethnicities, ethnicResult{
+			Ethnic:     ethnic,
+			New:        counts[ethnic][assignmentNew],
+			Preserved:  counts[ethnic][assignmentPreserved],
+			Reassigned: counts[ethnic][assignmentReassigned],
+			Pinned:     counts[ethnic][assignmentPinned],
+			Skipped:    counts[ethnic][assignmentSkipped],
+		})
+		result.Preserved += counts[ethnic][assignmentPreserved]
+	}
+
+	for _, a := range s.assignments {
+		if a.Kind != assignmentNew && a.Kind != assignmentReassigned {
+			continue
+		}
+		result.Assigned = append(result.Assigned, assignedPlayer{
+			ID:       a.Person.ID,
+			Ethnic:   a.Person.Ethnic,
+			Role:     a.Person.Role,
+			Age:      max(a.Person.Age, 0), // unknown when 0 or less
+			Image:    a.Image,
+			Status:   a.Kind,
+			Fallback: a.Fallback,
+		})
+	}
+}
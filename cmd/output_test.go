@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// expectFailure checks that a run failed with the exit code and the error code
+// of class
+func expectFailure(t *testing.T, output commandResult, run jaqenRun, class failureClass) {
+	t.Helper()
+
+	if run.exitCode != class.Exit || output.ExitCode != class.Exit {
+		t.Fatalf("expected exit code %d, got %d with %d in the json: %s", class.Exit, run.exitCode, output.ExitCode, run.stdout)
+	}
+	if output.OK || len(output.Errors) != 1 || output.Errors[0].Code != class.Code {
+		t.Fatalf("expected one %s error, got %v", class.Code, output.Errors)
+	}
+}
+
+func TestMapFaces_ConfigError(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n", "African/a.png")
+
+	output, run := jsonResult(t, dir, "--img=faces", "--version=1999")
+	expectFailure(t, output, run, failConfig)
+}
+
+func TestMapFaces_RTFParseError(t *testing.T) {
+	dir := newTestFacepack(t, "", "African/a.png")
+	writeTestFile(t, filepath.Join(dir, "newgen.rtf"), []byte("| UID | Nat | 2nd Nat |\r\n| 1 | NGA |  |\r\n"))
+
+	output, run := jsonResult(t, dir, "--img=faces")
+	expectFailure(t, output, run, failRTF)
+}
+
+func TestMapFaces_PoolExhausted(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n| 2 | NGA |  | 3 |\r\n", "African/a.png")
+
+	output, run := jsonResult(t, dir, "--img=faces")
+	expectFailure(t, output, run, failExhausted)
+}
+
+func TestMapFaces_WriteError(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n", "African/a.png")
+
+	// the timestamp of the backup makes its name longer than a file name may
+	// be, which fails even for root, unlike a read-only folder
+	xmlName := strings.Repeat("x", 240) + ".xml"
+	writeTestFile(t, filepath.Join(dir, xmlName), []byte(testConfigXML()))
+
+	output, run := jsonResult(t, dir, "--img=faces", "--xml="+xmlName)
+	expectFailure(t, output, run, failWrite)
+	if content := readTestFile(t, filepath.Join(dir, xmlName)); content != testConfigXML() {
+		t.Fatalf("expected the xml file to be left as it is, got:\n%s", content)
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+)
+
+// imageRelativePath is the path from the folder of the xml file to the image
+// directory, football manager reads image paths relative to that folder
+func imageRelativePath(imgDir string, xmlPath string) (string, error) {
+	imgDirPathAbs, err := filepath.Abs(imgDir)
+	if err != nil {
+		return "", err
+	}
+	xmlFilePathAbs, err := filepath.Abs(xmlPath)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(xmlFilePathAbs), imgDirPathAbs)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+
+	return filepath.ToSlash(rel), nil
+}
+
+// parseImageLayer reads an image layer flag, ex: 10:path/to/addon or
+// path/to/addon for the default priority
+func parseImageLayer(value string) (mapper.ImageRoot, error) {
+	if priority, layerPath, ok := strings.Cut(value, ":"); ok {
+		if number, err := strconv.Atoi(priority); err == nil {
+			if layerPath == "" {
+				return mapper.ImageRoot{}, fmt.Errorf(`image layer "%s" has no path`, value)
+			}
+			return mapper.ImageRoot{Path: layerPath, Priority: number}, nil
+		}
+	}
+
+	return mapper.ImageRoot{Path: value, Priority: internal.DefaultLayerPriority}, nil
+}
+
+// imageRoots are the image directory and the image layers on top of it, with
+// the path from the xml file to each of them
+func imageRoots() ([]mapper.ImageRoot, error) {
+	roots := append([]mapper.ImageRoot{{Path: imgDir}}, imageLayers...)
+
+	for i := range roots {
+		from, err := imageRelativePath(roots[i].Path, xmlPath)
+		if err != nil {
+			return nil, err
+		}
+		roots[i].From = from
+	}
+
+	return mapper.SortImageRoots(roots), nil
+}
+
+// resolveImagePath turns an image path from the xml file back into a path on
+// disk, without the file extension
+func resolveImagePath(imagePath mapper.FilePath, xmlPath string) string {
+	return filepath.Join(filepath.Dir(xmlPath), filepath.FromSlash(path.Clean(string(imagePath))))
+}
+
+// pinImages maps the players with a pinned image, pins of images that don't
+// exist are reported and removed so that those players are mapped as usual
+func pinImages(mapping *mapper.Mapping, playerOverrides map[mapper.PlayerID]mapper.PlayerOverride, roots []mapper.ImageRoot) {
+	for id, override := range playerOverrides {
+		if override.Image == "" {
+			continue
+		}
+
+		root, ok := mapper.FindImage(roots, override.Image)
+		if !ok {
+			warn("missing_pinned_image", "pinned image %s for player %s does not exist, the player is mapped as usual", override.Image, id)
+			delete(playerOverrides, id)
+			continue
+		}
+
+		mapping.MapToImage(id, mapper.FilePath(path.Join(root.From, string(override.Image))))
+	}
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	mapper "jaqen/pkgs"
+)
+
+func TestImageRelativePath_XMLLocations(t *testing.T) {
+	root := t.TempDir()
+
+	cases := []struct {
+		imgDir   string
+		xmlPath  string
+		expected string
+	}{
+		{filepath.Join(root, "faces"), filepath.Join(root, "faces", "config.xml"), ""},
+		{filepath.Join(root, "faces"), filepath.Join(root, "config.xml"), "faces"},
+		{filepath.Join(root, "faces"), filepath.Join(root, "config", "config.xml"), "../faces"},
+		{filepath.Join(root, "faces", "pack"), filepath.Join(root, "config", "xml", "config.xml"), "../../faces/pack"},
+	}
+
+	for _, c := range cases {
+		rel, err := imageRelativePath(c.imgDir, c.xmlPath)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if rel != c.expected {
+			t.Fatalf("expected %q for %s and %s, got %q", c.expected, c.imgDir, c.xmlPath, rel)
+		}
+	}
+}
+
+func TestResolveImagePath_XMLOutsideImageDirectory(t *testing.T) {
+	root := t.TempDir()
+	imgDir := filepath.Join(root, "faces")
+	xmlPath := filepath.Join(root, "config", "config.xml")
+
+	rel, err := imageRelativePath(imgDir, xmlPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	imagePath := mapper.FilePath(rel + "/African/face")
+	expected := filepath.Join(imgDir, "African", "face")
+	if resolved := resolveImagePath(imagePath, xmlPath); resolved != expected {
+		t.Fatalf("expected %s, got %s", expected, resolved)
+	}
+}
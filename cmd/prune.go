@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneRemove   bool
+	pruneReassign bool
+)
+
+const (
+	flagkeyRemove   = "remove"
+	flagkeyReassign = "reassign"
+)
+
+type missingImage struct {
+	ID    mapper.PlayerID `json:"uid"`
+	Image mapper.FilePath `json:"image"`
+}
+
+type pruneResult struct {
+	Mapped     int            `json:"mapped"`
+	Missing    []missingImage `json:"missing"`
+	Removed    int            `json:"removed"`
+	Reassigned int            `json:"reassigned"`
+}
+
+func pruneMapping(cmd *cobra.Command, _ []string) {
+	var run *mappingRun
+	if pruneReassign {
+		// new images come from the pool jaqen uses, with the pinned images
+		// mapped and the usage counts of --balanced
+		run = preparePool(cmd)
+	} else {
+		applyMapperConfig(loadConfig(cmd))
+
+		if _, err := mapper.LookupFMVersion(fmVersion); err != nil {
+			fail(failConfig, err)
+		}
+
+		if _, err := os.Stat(xmlPath); err != nil {
+			fail(failConfig, fmt.Errorf("xml file could not be found: %w", err))
+		}
+
+		mapping, err := mapper.NewMapping(xmlPath, fmVersion)
+		if err != nil {
+			fail(failXML, err)
+		}
+		run = &mappingRun{mapping: mapping}
+	}
+	mapping := run.mapping
+
+	images := mapping.Images()
+
+	missing := make([]mapper.PlayerID, 0)
+	imageFiles := mapper.NewImageFiles()
+	for id, imagePath := range images {
+		if !imageFiles.Exists(resolveImagePath(imagePath, xmlPath)) {
+			missing = append(missing, id)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	pruned := &pruneResult{Mapped: len(images), Missing: []missingImage{}}
+	result.Data = pruned
+	for _, id := range missing {
+		pruned.Missing = append(pruned.Missing, missingImage{ID: id, Image: images[id]})
+	}
+
+	if len(missing) == 0 {
+		if !jsonOutput() {
+			fmt.Printf("all %d mapped images exist\n", len(images))
+		}
+		printResult()
+		return
+	}
+
+	if !jsonOutput() {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "UID\tMISSING IMAGE")
+		for _, id := range missing {
+			fmt.Fprintf(table, "%s\t%s\n", id, images[id])
+		}
+		table.Flush()
+	}
+
+	if !pruneRemove && !pruneReassign {
+		if !jsonOutput() {
+			fmt.Printf("%d of %d mapped images are missing, use --%s or --%s to update the xml file\n", len(missing), len(images), flagkeyRemove, flagkeyReassign)
+		}
+		printResult()
+		return
+	}
+
+	for _, id := range missing {
+		mapping.Remove(id)
+	}
+
+	if pruneReassign {
+		run.useHeldImages()
+
+		for _, id := range missing {
+			ethnic, imagePath, ok := mapper.SplitEthnicImagePath(images[id])
+			if !ok {
+				warn("unknown_ethnic", "cannot tell the ethnic of %s from %s, the player is left unmapped", id, images[id])
+				pruned.Removed++
+				continue
+			}
+
+			player := mapper.Person{ID: id, Ethnic: ethnic, SkinTone: mapper.SkinToneOfImage(imagePath), Role: mapper.RolePlayer}
+			if strings.HasPrefix(string(imagePath), mapper.StaffFolder+"/") {
+				player.Role = mapper.RoleStaff
+			}
+			choice, err := run.imagePool.GetImagePathWithFallback(player, !allowDuplicate, run.fallbackFor(player.Ethnic))
+			if errors.Is(err, mapper.ErrPlayerSkipped) {
+				warn("player_skipped", "player %s was skipped: %s, the player is left unmapped", id, err)
+				pruned.Removed++
+				continue
+			}
+			if err != nil {
+				failOnImages(err)
+			}
+
+			mapping.MapToImage(id, run.imagePool.FromPath(choice.Ethnic, choice.Path))
+			pruned.Reassigned++
+		}
+	} else {
+		pruned.Removed = len(missing)
+	}
+
+	if err := mapping.Save(); err != nil {
+		fail(failXML, err)
+	}
+
+	if _, err := mapper.BackupXML(xmlPath, backupCount); err != nil {
+		fail(failWrite, err)
+	}
+
+	if err := mapping.Write(xmlPath); err != nil {
+		fail(failWrite, err)
+	}
+
+	if !jsonOutput() {
+		if pruneReassign {
+			fmt.Printf("reassigned %d players with missing images, %d left unmapped\n", pruned.Reassigned, pruned.Removed)
+		} else {
+			fmt.Printf("removed %d players with missing images\n", pruned.Removed)
+		}
+	}
+	printResult()
+}
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Finds mapped images that no longer exist",
+	Long:  "Reports the players in the XML file whose image no longer exists in the image directory. Removes them with --remove, or gives them a new image with --reassign.",
+	Args:  cobra.NoArgs,
+	Run:   pruneMapping,
+}
+
+func init() {
+	pruneCmd.Flags().BoolVar(&pruneRemove, flagkeyRemove, false, "Remove players with missing images from the XML file")
+	pruneCmd.Flags().BoolVar(&pruneReassign, flagkeyReassign, false, "Assign a new image to players with missing images")
+	rootCmd.AddCommand(pruneCmd)
+}
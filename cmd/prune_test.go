@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	mapper "jaqen/pkgs"
+)
+
+func pruneAndReadMapping(t *testing.T, dir string, args ...string) map[mapper.PlayerID]mapper.FilePath {
+	t.Helper()
+
+	run := runJaqen(t, dir, append([]string{"prune", "--img=faces", "--reassign"}, args...)...)
+	if run.exitCode != 0 {
+		t.Fatalf("expected prune to succeed, got %d: %s", run.exitCode, run.stderr)
+	}
+
+	mapping, err := mapper.NewMapping(filepath.Join(dir, "config.xml"), "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return mapping.Images()
+}
+
+func TestPrune_ReassignSkipsPinnedImages(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		dir := newTestFacepack(t, "", "African/a.png", "African/b.png")
+		writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(testConfigXML("1", "faces/African/gone")))
+		writeTestFile(t, filepath.Join(dir, "jaqen.toml"), []byte("[player_override]\n2 = 'African/a'\n"))
+
+		images := pruneAndReadMapping(t, dir)
+		if images["1"] != "faces/African/b" || images["2"] != "faces/African/a" {
+			t.Fatalf("expected the pinned image to stay with its player, got %v", images)
+		}
+	}
+}
+
+func TestPrune_ReassignBalanced(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		dir := newTestFacepack(t, "", "African/a.png", "African/b.png")
+		writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(testConfigXML("1", "faces/African/gone", "3", "faces/African/a")))
+
+		images := pruneAndReadMapping(t, dir, "--allow_duplicate", "--balanced")
+		if images["1"] != "faces/African/b" {
+			t.Fatalf("expected the least used image, got %v", images)
+		}
+	}
+}
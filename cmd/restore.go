@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+type restoreResult struct {
+	Backups  []mapper.Backup `json:"backups"`
+	Restored string          `json:"restored,omitempty"` // path of the restored backup
+}
+
+func restoreBackup(cmd *cobra.Command, args []string) {
+	loadConfig(cmd)
+
+	backups, err := mapper.ListBackups(xmlPath)
+	if err != nil {
+		fail(failGeneric, err)
+	}
+	restored := &restoreResult{Backups: backups}
+	result.Data = restored
+
+	if len(args) == 0 {
+		if jsonOutput() {
+			printResult()
+			return
+		}
+
+		if len(backups) == 0 {
+			fmt.Printf("no backups found for %s\n", xmlPath)
+			return
+		}
+
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "#\tCREATED\tFILE")
+		for i, backup := range backups {
+			fmt.Fprintf(table, "%d\t%s\t%s\n", i+1, backup.CreatedAt.Format(time.DateTime), backup.Path)
+		}
+		table.Flush()
+		return
+	}
+
+	backupPath := args[0]
+	if number, err := strconv.Atoi(args[0]); err == nil {
+		if number < 1 || number > len(backups) {
+			fail(failConfig, fmt.Errorf("backup #%d does not exist, there are %d backups", number, len(backups)))
+		}
+		backupPath = backups[number-1].Path
+	}
+
+	if err := mapper.RestoreBackup(xmlPath, backupPath, backupCount); err != nil {
+		fail(failWrite, err)
+	}
+	restored.Restored = backupPath
+
+	if !jsonOutput() {
+		fmt.Printf("restored %s from %s\n", xmlPath, backupPath)
+	}
+	printResult()
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [backup number or file]",
+	Short: "Lists or restores XML file backups",
+	Long:  "Lists the backups of the XML file, newest first. Restores the backup with the given number or path, after backing up the current XML file.",
+	Args:  cobra.MaximumNArgs(1),
+	Run:   restoreBackup,
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+}
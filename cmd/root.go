@@ -1,167 +1,185 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	internal "jaqen/internal"
 	mapper "jaqen/pkgs"
-	"log"
 	"os"
-	"path"
-	"path/filepath"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	preserve       bool
-	xmlPath        string
-	rtfPath        string
-	imgDir         string
-	fmVersion      string
-	configPath     string
-	allowDuplicate bool
+	preserve        bool
+	xmlPath         string
+	rtfPath         string
+	staffRTFPath    string
+	imgDir          string
+	fmVersion       string
+	configPath      string
+	allowDuplicate  bool
+	dryRun          bool
+	listAssigned    bool
+	backupCount     int
+	seed            int64
+	stableHash      bool
+	balanced        bool
+	recursive       bool
+	warnCapacity    bool
+	imageValidation string
+	dedupe          bool
+	layerFlags      []string
+	outputFormat    string
+	unknownNation   string
+	defaultEthnic   string
+	suggestStubs    bool
+	gameDateValue   string
 )
 
 const (
-	flagkeysPreserve  = "preserve"
-	flagkeysXml       = "xml"
-	flagkeysRtf       = "rtf"
-	flagkeysImg       = "img"
+	flagkeysPreserve = "preserve"
+	flagkeysXml      = "xml"
+	flagkeysRtf      = "rtf"
+	flagkeyStaffRtf  = "staff_rtf"
+	flagkeysImg      = "img"
 	flagkeyFmVersion = "version"
 	flagkeyConfig    = "config"
 	flagkeyDuplicate = "allow_duplicate"
+	flagkeyDryRun    = "dry_run"
+	flagkeyList      = "list"
+	flagkeyBackups   = "backup_count"
+	flagkeySeed      = "seed"
+	flagkeyStable    = "stable_hash"
+	flagkeyBalanced  = "balanced"
+	flagkeyRecursive = "recursive"
+	flagkeyWarnCap   = "warn_capacity"
+	flagkeyValidate  = "validate"
+	flagkeyDedupe    = "dedupe"
+	flagkeyLayer     = "layer"
+	flagkeyOutput    = "output"
+	flagkeyUnknown   = "unknown_nationality"
+	flagkeyDefEthnic = "default_ethnic"
+	flagkeySuggest   = "suggest_overrides"
+	flagkeyGameDate  = "game_date"
 )
 
 func mapFaces(cmd *cobra.Command, _ []string) {
-	if _, err := os.Stat(configPath); err == nil {
-		configFromFile, err := internal.ReadConfig(configPath)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	run := prepareRun(cmd)
 
-		if !cmd.Flags().Changed(flagkeysPreserve) && configFromFile.Preserve != nil {
-			preserve = *configFromFile.Preserve
-		}
-		if !cmd.Flags().Changed(flagkeysImg) && configFromFile.IMGPath != nil {
-			imgDir = *configFromFile.IMGPath
-		}
-		if !cmd.Flags().Changed(flagkeysImg) && configFromFile.IMGPath != nil {
-			imgDir = *configFromFile.IMGPath
-		}
-		if !cmd.Flags().Changed(flagkeysXml) && configFromFile.XMLPath != nil {
-			xmlPath = *configFromFile.XMLPath
-		}
-		if !cmd.Flags().Changed(flagkeysRtf) && configFromFile.RTFPath != nil {
-			rtfPath = *configFromFile.RTFPath
-		}
-		if !cmd.Flags().Changed(flagkeyFmVersion) && configFromFile.FMVersion != nil {
-			fmVersion = *configFromFile.FMVersion
+	warnings, err := run.checkCapacity()
+	for _, warning := range warnings {
+		warn("capacity", "%s", warning)
+	}
+	if err != nil {
+		if !warnCapacity {
+			fail(failExhausted, err)
 		}
-		if !cmd.Flags().Changed(flagkeyDuplicate) && configFromFile.AllowDuplicate != nil {
-			allowDuplicate = *configFromFile.AllowDuplicate
+		warn("capacity", "%s", err)
+	}
+
+	summary := &runSummary{}
+
+	for _, player := range run.players {
+		player, kind := run.planPlayer(player)
+		if kind == assignmentPinned || kind == assignmentPreserved {
+			image, _ := run.mapping.Image(player.ID)
+			summary.add(player, image, kind)
+			continue
 		}
 
-		err = mapper.OverrideNationEthnicMapping(*configFromFile.MappingOverride)
+		choice, err := run.imagePool.GetImagePathWithFallback(player, !allowDuplicate, run.fallbackFor(player.Ethnic))
+		if errors.Is(err, mapper.ErrPlayerSkipped) {
+			summary.addSkipped(player, err)
+			if jsonOutput() {
+				warn("player_skipped", "player %s was skipped: %s", player.ID, err)
+			}
+			continue
+		}
 		if err != nil {
-			log.Fatalln(err)
+			failOnImages(err)
 		}
-	}
-
-	if _, err := os.Stat(imgDir); err != nil {
-		log.Fatalln(fmt.Errorf("image directory could not be found: %w", err))
-	}
-
-	if _, err := os.Stat(xmlPath); err != nil {
-		log.Fatalln(fmt.Errorf("xml file could not be found: %w", err))
-	}
 
-	if _, err := os.Stat(rtfPath); err != nil {
-		log.Fatalln(fmt.Errorf("rtf file could not be found: %w", err))
-	}
+		imgPath := run.imagePool.FromPath(choice.Ethnic, choice.Path)
+		run.mapping.MapToImage(player.ID, imgPath)
 
-	mapping, err := mapper.NewMapping(xmlPath, fmVersion)
-	if err != nil {
-		log.Fatalln(err)
+		summary.addFallback(player, imgPath, kind, choice.Fallback)
 	}
 
-	imagePool, err := mapper.NewImagePool(imgDir)
-	if err != nil {
-		log.Fatalln(err)
-	}
+	result.DryRun = dryRun
+	summary.setResult()
 
-	if !allowDuplicate {
-		if err := imagePool.ExcludeImages(mapping.AssignedImages()); err != nil {
-			log.Fatalln(err)
+	if dryRun {
+		if !jsonOutput() {
+			summary.print(os.Stdout, listAssigned)
+			printOverrideStubs(os.Stdout)
 		}
+		printResult()
+		return
 	}
-
-	players, err := mapper.GetPlayers(rtfPath)
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	imgDirPathAbs, err := filepath.Abs(imgDir)
-	if err != nil {
-		log.Fatalln(err)
-	}
-	xmlFilePathAbs, err := filepath.Abs(xmlPath)
-	if err != nil {
-		log.Fatalln(err)
+	if !jsonOutput() {
+		summary.printFallbacks(os.Stdout)
 	}
 
-	rel := ""
-	isXMLFileInsideImgDir := imgDirPathAbs == filepath.Dir(xmlFilePathAbs)
-	if !isXMLFileInsideImgDir {
-		rel, err = filepath.Rel(xmlFilePathAbs, imgDirPathAbs)
-		if err != nil {
-			log.Fatalln(err)
-		}
+	if err := run.mapping.Save(); err != nil {
+		fail(failXML, err)
 	}
-	rel = strings.TrimPrefix(rel, "./")
-
-	for _, player := range players {
-		if preserve && mapping.Exist(player.ID) {
-			continue
-		}
 
-		imgFilename, err := imagePool.GetRandomImagePath(player.Ethnic, !allowDuplicate)
-		if err != nil {
-			log.Fatalln(err)
-		}
-
-		mapping.MapToImage(player.ID, mapper.FilePath(path.Join(rel, string(player.Ethnic), string(imgFilename))))
+	if _, err := mapper.BackupXML(xmlPath, backupCount); err != nil {
+		fail(failWrite, err)
 	}
 
-	if err := mapping.Save(); err != nil {
-		log.Fatalln(err)
+	if err := run.mapping.Write(xmlPath); err != nil {
+		fail(failWrite, err)
 	}
 
-	if err := mapping.Write(xmlPath); err != nil {
-		log.Fatalln(err)
-	}
+	printResult()
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "jaqen",
 	Short: "Creates your mapping file for Football Manager regen images",
 	Long:  `CLI that creates your mapping file for Football Manager regen images.`,
-	Run:   mapFaces,
+	// fail reports the errors of Execute, in text or json
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, _ []string) {
+		result.Command = cmd.Name()
+		validateOutput()
+	},
+	Run: mapFaces,
 }
 
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
-		log.Fatalln(err)
+		fail(failConfig, err)
 	}
 }
 
 func init() {
-	rootCmd.Flags().BoolVarP(&preserve, flagkeysPreserve, "p", internal.DefaultPreserve, "Preserve previous settings")
-	rootCmd.Flags().StringVarP(&xmlPath, flagkeysXml, "x", internal.DefaultXMLPath, "Specify XML file path")
-	rootCmd.Flags().StringVarP(&rtfPath, flagkeysRtf, "r", internal.DefaultRTFPath, "Specify RTF file path")
-	rootCmd.Flags().StringVarP(&imgDir, flagkeysImg, "i", internal.DefaultImagesPath, "Specify the image directory path")
-	rootCmd.Flags().StringVarP(&fmVersion, flagkeyFmVersion, "v", internal.DefaultFMVersion, "Specify the football manager version")
-	rootCmd.Flags().StringVarP(&configPath, flagkeyConfig, "c", internal.DefaultConfigPath, "Specify the config file path")
-	rootCmd.Flags().BoolVarP(&allowDuplicate, flagkeyDuplicate, "d", internal.DefaultAllowDuplicate, "Allow duplicate images")
+	rootCmd.PersistentFlags().BoolVarP(&preserve, flagkeysPreserve, "p", internal.DefaultPreserve, "Preserve previous settings")
+	rootCmd.PersistentFlags().StringVarP(&xmlPath, flagkeysXml, "x", internal.DefaultXMLPath, "Specify XML file path")
+	rootCmd.PersistentFlags().StringVarP(&rtfPath, flagkeysRtf, "r", internal.DefaultRTFPath, "Specify RTF file path")
+	rootCmd.PersistentFlags().StringVar(&staffRTFPath, flagkeyStaffRtf, "", "Specify the RTF file path of a staff search, to map staff faces along with the players")
+	rootCmd.PersistentFlags().StringVarP(&imgDir, flagkeysImg, "i", internal.DefaultImagesPath, "Specify the image directory path")
+	rootCmd.PersistentFlags().StringArrayVar(&layerFlags, flagkeyLayer, nil, "Add an image directory on top of --img, as PRIORITY:PATH or PATH, images with the same path are taken from the highest priority")
+	rootCmd.PersistentFlags().StringVarP(&fmVersion, flagkeyFmVersion, "v", internal.DefaultFMVersion, fmt.Sprintf("Specify the football manager version (%s)", strings.Join(mapper.FMVersionNames(), ", ")))
+	rootCmd.PersistentFlags().StringVar(&outputFormat, flagkeyOutput, outputText, "Print the result as text or json, json also has the warnings and errors with their codes")
+	rootCmd.PersistentFlags().StringVarP(&configPath, flagkeyConfig, "c", internal.DefaultConfigPath, "Specify the config file path")
+	rootCmd.PersistentFlags().Int64Var(&seed, flagkeySeed, 0, "Seed the random assignment to make runs reproducible")
+	rootCmd.PersistentFlags().BoolVar(&stableHash, flagkeyStable, internal.DefaultStableHash, "Derive each image from the player UID instead of picking it at random")
+	rootCmd.PersistentFlags().BoolVar(&balanced, flagkeyBalanced, internal.DefaultBalanced, "Spread duplicate images evenly by always picking among the least used ones")
+	rootCmd.PersistentFlags().BoolVar(&recursive, flagkeyRecursive, internal.DefaultRecursive, "Find images in every nested folder of the ethnic folders")
+	rootCmd.PersistentFlags().StringVar(&imageValidation, flagkeyValidate, internal.DefaultValidation, "How image files are checked before they are used (none, header, decode)")
+	rootCmd.PersistentFlags().BoolVar(&dedupe, flagkeyDedupe, internal.DefaultDedupe, "Treat the duplicates found by jaqen dedupe as one image when excluding duplicates")
+	rootCmd.PersistentFlags().StringVar(&unknownNation, flagkeyUnknown, internal.DefaultUnknownNation, "What to do with players whose nationality has no ethnic (fail, skip, default)")
+	rootCmd.PersistentFlags().StringVar(&defaultEthnic, flagkeyDefEthnic, "", "Ethnic of unknown nationalities with --unknown_nationality=default")
+	rootCmd.PersistentFlags().StringVar(&gameDateValue, flagkeyGameDate, "", "Date of the save, ex: 15/6/2030, to count ages from a bare date of birth. Defaults to today")
+	rootCmd.PersistentFlags().BoolVar(&suggestStubs, flagkeySuggest, false, "Add commented out [mapping_override] entries for unknown nationalities to the config file")
+	rootCmd.PersistentFlags().IntVar(&backupCount, flagkeyBackups, internal.DefaultBackupCount, "Number of XML backups to keep, 0 disables backups")
+	rootCmd.PersistentFlags().BoolVarP(&allowDuplicate, flagkeyDuplicate, "d", internal.DefaultAllowDuplicate, "Allow duplicate images")
+	rootCmd.Flags().BoolVar(&warnCapacity, flagkeyWarnCap, false, "Only warn instead of refusing to start when an ethnic does not have enough images")
+	rootCmd.Flags().BoolVar(&dryRun, flagkeyDryRun, false, "Report the planned assignments without writing the XML file")
+	rootCmd.Flags().BoolVar(&listAssigned, flagkeyList, false, "List every planned assignment in a dry run")
 }
@@ -0,0 +1,434 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	internal "jaqen/internal"
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+// mappingRun holds everything needed to map the players of the RTF file to
+// images, before any image is assigned
+type mappingRun struct {
+	mapping         *mapper.Mapping
+	imagePool       *mapper.ImagePool
+	players         []mapper.Person
+	playerOverrides map[mapper.PlayerID]mapper.PlayerOverride
+	fallbacks       map[string]mapper.FallbackPolicy
+}
+
+func prepareRun(cmd *cobra.Command) *mappingRun {
+	run := preparePool(cmd)
+
+	if _, err := os.Stat(rtfPath); err != nil {
+		fail(failConfig, fmt.Errorf("rtf file could not be found: %w", err))
+	}
+
+	if staffRTFPath != "" {
+		if _, err := os.Stat(staffRTFPath); err != nil {
+			fail(failConfig, fmt.Errorf("staff rtf file could not be found: %w", err))
+		}
+	}
+
+	players, unknowns, err := mapper.ReadPeople(rtfPath, readOptions(mapper.RolePlayer))
+	reportUnknownNationalities(unknowns)
+	if err != nil {
+		fail(failRTF, err)
+	}
+
+	if staffRTFPath != "" {
+		staff, unknowns, err := mapper.ReadPeople(staffRTFPath, readOptions(mapper.RoleStaff))
+		reportUnknownNationalities(unknowns)
+		if err != nil {
+			fail(failRTF, fmt.Errorf("staff rtf file: %w", err))
+		}
+		players = mergePeople(players, staff)
+	}
+	reportAges(players)
+
+	run.players = players
+	run.useHeldImages()
+	return run
+}
+
+// preparePool loads the xml file, maps the pinned images and builds the image
+// pool, the images of the xml file are not taken out of the pool until
+// useHeldImages is called
+func preparePool(cmd *cobra.Command) *mappingRun {
+	configFromFile := loadConfig(cmd)
+	applyMapperConfig(configFromFile)
+
+	if _, err := mapper.LookupFMVersion(fmVersion); err != nil {
+		fail(failConfig, err)
+	}
+
+	if err := mapper.ValidateReadOptions(readOptions(mapper.RolePlayer)); err != nil {
+		fail(failConfig, err)
+	}
+
+	roots, err := imageRoots()
+	if err != nil {
+		fail(failConfig, err)
+	}
+	for _, root := range roots {
+		if _, err := os.Stat(root.Path); err != nil {
+			fail(failConfig, fmt.Errorf("image directory could not be found: %w", err))
+		}
+	}
+
+	if _, err := os.Stat(xmlPath); err != nil {
+		fail(failConfig, fmt.Errorf("xml file could not be found: %w", err))
+	}
+
+	mapping, err := mapper.NewMapping(xmlPath, fmVersion)
+	if err != nil {
+		fail(failXML, err)
+	}
+	reportUnmanagedRecords(mapping)
+
+	playerOverrides := make(map[mapper.PlayerID]mapper.PlayerOverride)
+	if configFromFile.PlayerOverride != nil {
+		playerOverrides, err = mapper.ParsePlayerOverrides(*configFromFile.PlayerOverride)
+		if err != nil {
+			fail(failConfig, err)
+		}
+	}
+	fallbacks := make(map[string]mapper.FallbackPolicy)
+	if configFromFile.Fallback != nil {
+		fallbacks, err = toFallbackPolicies(*configFromFile.Fallback)
+		if err != nil {
+			fail(failConfig, err)
+		}
+	}
+
+	// pinned images are mapped first so that they are excluded from the pool
+	pinImages(mapping, playerOverrides, roots)
+
+	imagePool, err := mapper.NewLayeredImagePool(roots, imagePoolOptions())
+	if err != nil {
+		fail(failConfig, err)
+	}
+	configureImagePool(cmd, imagePool)
+	if missing := imagePool.MissingEthnics(); len(missing) > 0 {
+		warn("missing_ethnic_folder", "no image folder for ethnicities: %s", joinEthnics(missing))
+	}
+	if invalidImages := imagePool.InvalidImages(); len(invalidImages) > 0 {
+		warn("invalid_images", "left %d invalid image file(s) out of the pool, run jaqen stats to list them", len(invalidImages))
+	}
+
+	return &mappingRun{
+		mapping:         mapping,
+		imagePool:       imagePool,
+		playerOverrides: playerOverrides,
+		fallbacks:       fallbacks,
+	}
+}
+
+// useHeldImages takes the images held by players out of the pool, or counts
+// them as used when duplicates are allowed
+func (run *mappingRun) useHeldImages() {
+	if !allowDuplicate {
+		if err := run.imagePool.ExcludeImages(run.heldImages()); err != nil {
+			fail(failGeneric, err)
+		}
+	} else {
+		run.imagePool.AddUsage(run.heldImages())
+	}
+}
+
+// heldImages are the images of the xml file that stay with their player. The
+// image of a player who gets a new one is free again, so that a player can
+// get the same image back, ex: with --stable_hash.
+func (run *mappingRun) heldImages() []mapper.FilePath {
+	reassigned := make(map[mapper.PlayerID]bool)
+	for _, player := range run.players {
+		if _, kind := run.planPlayer(player); kind == assignmentReassigned {
+			reassigned[player.ID] = true
+		}
+	}
+
+	held := make([]mapper.FilePath, 0)
+	for id, image := range run.mapping.Images() {
+		if !reassigned[id] {
+			held = append(held, image)
+		}
+	}
+	return held
+}
+
+// mergePeople adds the staff to the players, a player who is also on the
+// staff, ex: a player-coach, keeps their player face
+func mergePeople(players []mapper.Person, staff []mapper.Person) []mapper.Person {
+	ids := make(map[mapper.PlayerID]bool, len(players))
+	for _, player := range players {
+		ids[player.ID] = true
+	}
+
+	for _, person := range staff {
+		if !ids[person.ID] {
+			players = append(players, person)
+			ids[person.ID] = true
+		}
+	}
+	return players
+}
+
+func (run *mappingRun) fallbackFor(ethnic mapper.Ethnic) mapper.FallbackPolicy {
+	if policy, ok := run.fallbacks[string(ethnic)]; ok {
+		return policy
+	}
+	return run.fallbacks[mapper.DefaultFallbackKey]
+}
+
+func hasFallback(policy mapper.FallbackPolicy) bool {
+	return len(policy.Ethnics) > 0 || (policy.Action != "" && policy.Action != mapper.FallbackFail)
+}
+
+// planPlayer applies the player overrides and tells whether the player keeps
+// their image or needs a new one from the pool
+func (run *mappingRun) planPlayer(player mapper.Person) (mapper.Person, assignmentKind) {
+	if override, ok := run.playerOverrides[player.ID]; ok {
+		player.Ethnic = override.Ethnic
+
+		if override.Image != "" {
+			return player, assignmentPinned
+		}
+	}
+
+	if !run.mapping.Exist(player.ID) {
+		return player, assignmentNew
+	}
+	if preserve {
+		return player, assignmentPreserved
+	}
+	return player, assignmentReassigned
+}
+
+type ethnicCapacity struct {
+	Ethnic         mapper.Ethnic `json:"ethnic"`
+	Players        int           `json:"players"`         // players of the ethnic in the RTF file
+	Staff          int           `json:"staff"`           // staff of the ethnic in the staff RTF file
+	Demand         int           `json:"demand"`          // players and staff that need a new image
+	StaffDemand    int           `json:"staff_demand"`    // staff that need a new image, part of demand
+	Images         int           `json:"images"`          // images in the ethnic folder
+	StaffImages    int           `json:"staff_images"`    // images in the staff folder, part of images
+	Available      int           `json:"available"`       // images that are not assigned yet
+	StaffAvailable int           `json:"staff_available"` // staff images that are not assigned yet, part of available
+	NoFolder       bool          `json:"no_folder"`
+}
+
+// playerHeadroom is what is left for players, who never get staff images
+func (c ethnicCapacity) playerHeadroom() int {
+	return (c.Available - c.StaffAvailable) - (c.Demand - c.StaffDemand)
+}
+
+// Headroom is the number of images left once everyone has one, staff images
+// left over cannot make up for missing player images
+func (c ethnicCapacity) Headroom() int {
+	return min(c.Available-c.Demand, c.playerHeadroom())
+}
+
+func (c ethnicCapacity) short() bool {
+	if allowDuplicate {
+		playersShort := c.Demand > c.StaffDemand && c.Available == c.StaffAvailable
+		return playersShort || (c.Demand > 0 && c.Available == 0)
+	}
+	return c.Headroom() < 0
+}
+
+func (run *mappingRun) capacity() []ethnicCapacity {
+	capacities := make(map[mapper.Ethnic]*ethnicCapacity)
+	for _, ethnic := range mapper.Ethnicities {
+		capacities[ethnic] = &ethnicCapacity{
+			Ethnic:         ethnic,
+			Images:         run.imagePool.Total(ethnic),
+			StaffImages:    run.imagePool.StaffTotal(ethnic),
+			Available:      run.imagePool.Available(ethnic),
+			StaffAvailable: run.imagePool.StaffAvailable(ethnic),
+			NoFolder:       !run.imagePool.HasEthnic(ethnic),
+		}
+	}
+
+	for _, player := range run.players {
+		player, kind := run.planPlayer(player)
+
+		capacity, ok := capacities[player.Ethnic]
+		if !ok {
+			capacity = &ethnicCapacity{Ethnic: player.Ethnic, NoFolder: true}
+			capacities[player.Ethnic] = capacity
+		}
+
+		if player.Role == mapper.RoleStaff {
+			capacity.Staff++
+		} else {
+			capacity.Players++
+		}
+		if kind == assignmentNew || kind == assignmentReassigned {
+			capacity.Demand++
+			if player.Role == mapper.RoleStaff {
+				capacity.StaffDemand++
+			}
+		}
+	}
+
+	result := make([]ethnicCapacity, 0, len(capacities))
+	for _, ethnic := range mapper.Ethnicities {
+		result = append(result, *capacities[ethnic])
+		delete(capacities, ethnic)
+	}
+	for _, capacity := range capacities {
+		result = append(result, *capacity)
+	}
+
+	return result
+}
+
+// checkCapacity reports every ethnic that will run out of images, ethnics
+// with a fallback policy are only warnings
+func (run *mappingRun) checkCapacity() ([]string, error) {
+	warnings := []string{}
+	shortages := []error{}
+
+	for _, capacity := range run.capacity() {
+		if !capacity.short() {
+			continue
+		}
+
+		shortage := fmt.Sprintf(
+			"ethnicity %s will run out of images: %d players need an image, %d of %d images are available",
+			capacity.Ethnic, capacity.Demand, capacity.Available, capacity.Images,
+		)
+		if capacity.StaffImages > 0 && capacity.playerHeadroom() < capacity.Available-capacity.Demand {
+			shortage = fmt.Sprintf(
+				"ethnicity %s will run out of player images: %d players need an image, %d of %d images outside of the %s folder are available",
+				capacity.Ethnic, capacity.Demand-capacity.StaffDemand, capacity.Available-capacity.StaffAvailable, capacity.Images-capacity.StaffImages, mapper.StaffFolder,
+			)
+		}
+		if capacity.NoFolder {
+			shortage = fmt.Sprintf("ethnicity %s has no image folder: %d players need an image", capacity.Ethnic, capacity.Demand)
+		}
+		if hasFallback(run.fallbackFor(capacity.Ethnic)) {
+			warnings = append(warnings, shortage+", using its fallback")
+		} else {
+			shortages = append(shortages, errors.New(shortage))
+		}
+	}
+
+	return warnings, errors.Join(shortages...)
+}
+
+func joinEthnics(ethnics []mapper.Ethnic) string {
+	names := make([]string, len(ethnics))
+	for i, ethnic := range ethnics {
+		names[i] = string(ethnic)
+	}
+	return strings.Join(names, ", ")
+}
+
+// reportUnmanagedRecords warns about portraits that are kept as they are
+// because their id does not match the football manager version
+func reportUnmanagedRecords(mapping *mapper.Mapping) {
+	version, err := mapper.LookupFMVersion(fmVersion)
+	if err != nil {
+		return
+	}
+
+	portraits := 0
+	example := ""
+	for _, record := range mapping.UnmanagedRecords() {
+		if version.ClassifyRecord(record) == mapper.RecordPortrait {
+			if portraits == 0 {
+				example = record.To
+			}
+			portraits++
+		}
+	}
+
+	if portraits > 0 {
+		warn("foreign_portrait", "%d portrait record(s) do not match the ids of version %s, ex: %s, they are kept as they are, check --%s", portraits, fmVersion, example, flagkeyFmVersion)
+	}
+}
+
+// reportAges warns about the people whose age is left unknown, either as
+// their date of birth gives an age of 0 or less or as it cannot be read
+func reportAges(people []mapper.Person) {
+	counted, invalid := 0, 0
+	countedExample, invalidExample := "", ""
+	for _, person := range people {
+		switch {
+		case person.AgeInvalid != "":
+			if invalid == 0 {
+				invalidExample = fmt.Sprintf("%s %s", person.ID, person.AgeInvalid)
+			}
+			invalid++
+		case person.AgeCounted && person.Age <= 0:
+			if counted == 0 {
+				countedExample = string(person.ID)
+			}
+			counted++
+		}
+	}
+
+	if counted > 0 {
+		warn("age", "the date of birth of %d person(s) gives an age of 0 or less, ex: %s, their age is left unknown, pass the date of your save with --%s", counted, countedExample, flagkeyGameDate)
+	}
+	if invalid > 0 {
+		warn("age", "the age or date of birth of %d person(s) cannot be read, ex: %s, their age is left unknown, dates are read day first", invalid, invalidExample)
+	}
+}
+
+// reportUnknownNationalities warns about the nationalities of the RTF file
+// that have no ethnic, and adds them to the config file when asked to
+func reportUnknownNationalities(unknowns []mapper.UnknownNationality) {
+	if len(unknowns) == 0 {
+		return
+	}
+
+	// without a lenient policy the error of the rtf file lists them already
+	outcome := ""
+	switch mapper.UnknownNationalityPolicy(unknownNation) {
+	case mapper.UnknownNationalityDefault:
+		outcome = "mapped as " + defaultEthnic
+	case mapper.UnknownNationalitySkip:
+		outcome = "skipped"
+	}
+
+	stubs := make([]internal.MappingOverrideStub, len(unknowns))
+	for i, unknown := range unknowns {
+		if outcome != "" {
+			warn("unknown_nationality", "unknown nationality %s, %s", unknown, outcome)
+		}
+
+		stubs[i] = internal.MappingOverrideStub{
+			Nation:  unknown.Code,
+			Ethnic:  defaultEthnic,
+			Comment: fmt.Sprintf("%d player(s), ex: %s", unknown.Count, unknown.Examples[0]),
+		}
+	}
+
+	if !suggestStubs {
+		warn("unknown_nationality", "add them to [mapping_override] in %s, or run with --%s to add commented out entries", configPath, flagkeySuggest)
+		return
+	}
+
+	if dryRun {
+		// a dry run writes nothing, the stubs are listed with its summary
+		newStubs, err := internal.NewMappingOverrideStubs(configPath, stubs)
+		if err != nil {
+			fail(failConfig, err)
+		}
+		result.OverrideStubs = append(result.OverrideStubs, newStubs...)
+		return
+	}
+
+	added, err := internal.AddMappingOverrideStubs(configPath, stubs)
+	if err != nil {
+		fail(failWrite, err)
+	}
+	warn("mapping_override_stubs", "added %d commented out [mapping_override] entries to %s, fill in their ethnic and uncomment them", added, configPath)
+}
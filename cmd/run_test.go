@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"maps"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	mapper "jaqen/pkgs"
+)
+
+func TestEthnicCapacity_StaffImagesOnlyServeStaff(t *testing.T) {
+	capacity := ethnicCapacity{Demand: 3, Images: 5, StaffImages: 3, Available: 5, StaffAvailable: 3}
+	if capacity.Headroom() != -1 || !capacity.short() {
+		t.Fatalf("expected 3 players to be short of the 2 player images, got headroom %d", capacity.Headroom())
+	}
+
+	capacity.StaffDemand = 2
+	if capacity.Headroom() != 1 || capacity.short() {
+		t.Fatalf("expected 1 player and 2 staff to fit, got headroom %d", capacity.Headroom())
+	}
+
+	capacity.Demand = 6
+	capacity.StaffDemand = 5
+	if capacity.Headroom() != -1 || !capacity.short() {
+		t.Fatalf("expected 6 people to be short of 5 images, got headroom %d", capacity.Headroom())
+	}
+}
+
+func TestMapFaces_StableHashKeepsFacesAcrossRuns(t *testing.T) {
+	dir := newTestFacepack(t,
+		"| 2000133469 | NGA |  | 3 |\r\n| 2000133470 | NGA |  | 3 |\r\n",
+		"African/img0.png", "African/img1.png", "African/img2.png", "African/img3.png",
+	)
+
+	faces := func() map[mapper.PlayerID]mapper.FilePath {
+		run := runJaqen(t, dir, "--img=faces", "--stable_hash")
+		if run.exitCode != 0 {
+			t.Fatalf("expected the run to succeed, got %d: %s", run.exitCode, run.stderr)
+		}
+
+		mapping, err := mapper.NewMapping(filepath.Join(dir, "config.xml"), "2024")
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		return mapping.Images()
+	}
+
+	expected := faces()
+	if len(expected) != 2 {
+		t.Fatalf("expected 2 mapped players, got %v", expected)
+	}
+	for i := 0; i < 3; i++ {
+		if images := faces(); !maps.Equal(images, expected) {
+			t.Fatalf("expected the same faces on run %d, got %v instead of %v", i+2, images, expected)
+		}
+	}
+}
+
+func TestMapFaces_DryRunListsOverrideStubs(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | XYZ |  | 3 |\r\n| 2 | NGA |  | 3 |\r\n", "African/a.png", "African/b.png")
+	config := "unknown_nationality = 'skip'\n"
+	writeTestFile(t, filepath.Join(dir, "jaqen.toml"), []byte(config))
+
+	output, run := jsonResult(t, dir, "--img=faces", "--dry_run", "--suggest_overrides")
+	if run.exitCode != 0 {
+		t.Fatalf("expected the dry run to succeed, got %d: %s", run.exitCode, run.stderr)
+	}
+	if len(output.OverrideStubs) != 1 || output.OverrideStubs[0].Nation != "XYZ" {
+		t.Fatalf("expected the XYZ stub to be listed, got %v", output.OverrideStubs)
+	}
+	if content := readTestFile(t, filepath.Join(dir, "jaqen.toml")); content != config {
+		t.Fatalf("expected the config file to be left as it is, got:\n%s", content)
+	}
+}
+
+func TestMapFaces_UnreadableDateOfBirthIsReported(t *testing.T) {
+	dir := newTestFacepack(t, "", "African/a.png", "African/b.png")
+	writeTestFile(t, filepath.Join(dir, "newgen.rtf"), []byte("| UID | Nat | 2nd Nat | DoB | Ethnicity |\r\n"+
+		"| 1 | NGA |  | 12/31/2006 | 3 |\r\n"+
+		"| 2 | NGA |  | 1/7/2000 | 3 |\r\n"))
+
+	output, run := jsonResult(t, dir, "--img=faces", "--game_date=1/6/2030")
+	if run.exitCode != 0 {
+		t.Fatalf("expected the run to succeed, got %d: %s", run.exitCode, run.stdout)
+	}
+	if len(output.Assigned) != 2 {
+		t.Fatalf("expected both players to get an image, got %v", output.Assigned)
+	}
+	found := false
+	for _, warning := range output.Warnings {
+		found = found || (warning.Code == "age" && strings.Contains(warning.Message, "1 12/31/2006"))
+	}
+	if !found {
+		t.Fatalf("expected an age warning for player 1, got %v", output.Warnings)
+	}
+}
+
+func TestMapFaces_DryRunWritesNothing(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n| 2 | NGA |  | 3 |\r\n", "African/a.png", "African/b.png")
+	xml := testConfigXML("1", "faces/African/a")
+	config := "preserve = true\nunknown_nationality = 'skip'\n"
+	writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(xml))
+	writeTestFile(t, filepath.Join(dir, "jaqen.toml"), []byte(config))
+
+	output, run := jsonResult(t, dir, "--img=faces", "--dry_run", "--suggest_overrides")
+	if run.exitCode != 0 {
+		t.Fatalf("expected the dry run to succeed, got %d: %s", run.exitCode, run.stdout)
+	}
+	if len(output.Assigned) != 1 || output.Assigned[0].ID != "2" {
+		t.Fatalf("expected player 2 to be planned, got %v", output.Assigned)
+	}
+
+	if content := readTestFile(t, filepath.Join(dir, "config.xml")); content != xml {
+		t.Fatalf("expected the xml file to be left as it is, got:\n%s", content)
+	}
+	if content := readTestFile(t, filepath.Join(dir, "jaqen.toml")); content != config {
+		t.Fatalf("expected the config file to be left as it is, got:\n%s", content)
+	}
+	backups, err := mapper.ListBackups(filepath.Join(dir, "config.xml"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(backups) != 0 {
+		t.Fatalf("expected no backup, got %v", backups)
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	mapper "jaqen/pkgs"
+
+	"github.com/spf13/cobra"
+)
+
+type statsResult struct {
+	Ethnicities   []ethnicCapacity      `json:"ethnicities"`
+	InvalidImages []mapper.InvalidImage `json:"invalid_images"`
+}
+
+func printStats(cmd *cobra.Command, _ []string) {
+	run := prepareRun(cmd)
+
+	capacities := run.capacity()
+	invalidImages := run.imagePool.InvalidImages()
+
+	if jsonOutput() {
+		result.Data = statsResult{Ethnicities: capacities, InvalidImages: invalidImages}
+		printResult()
+		return
+	}
+
+	table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ETHNIC\tPLAYERS\tSTAFF\tNEED IMAGE\tIMAGES\tUSED\tAVAILABLE\tHEADROOM")
+
+	for _, capacity := range capacities {
+		headroom := fmt.Sprint(capacity.Headroom())
+		if allowDuplicate && capacity.Available > 0 {
+			headroom = "duplicates"
+		}
+		if capacity.short() {
+			headroom += " !"
+		}
+
+		images := fmt.Sprint(capacity.Images)
+		available := fmt.Sprint(capacity.Available)
+		if capacity.StaffImages > 0 {
+			images = fmt.Sprintf("%d (%d staff)", capacity.Images, capacity.StaffImages)
+			available = fmt.Sprintf("%d (%d staff)", capacity.Available, capacity.StaffAvailable)
+		}
+		if capacity.NoFolder {
+			images = "no folder"
+		}
+
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%s\t%d\t%s\t%s\n",
+			capacity.Ethnic,
+			capacity.Players,
+			capacity.Staff,
+			capacity.Demand,
+			images,
+			capacity.Images-capacity.Available,
+			available,
+			headroom,
+		)
+	}
+	table.Flush()
+
+	if len(invalidImages) == 0 {
+		return
+	}
+
+	fmt.Printf("\n%d invalid image file(s) left out of the pool:\n", len(invalidImages))
+	table = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ETHNIC\tFILE\tREASON")
+	for _, invalidImage := range invalidImages {
+		filePath := filepath.Join(invalidImage.Root, string(invalidImage.Ethnic), filepath.FromSlash(invalidImage.Path))
+		fmt.Fprintf(table, "%s\t%s\t%s\n", invalidImage.Ethnic, filePath, invalidImage.Reason)
+	}
+	table.Flush()
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Compares the images available to the players that need one",
+	Long:  "Counts the players of the RTF file per ethnic and the images that are used and available in each ethnic folder, shows how many images are left once every player has one and lists the image files that were left out.",
+	Args:  cobra.NoArgs,
+	Run:   printStats,
+}
+
+func init() {
+	rootCmd.AddCommand(statsCmd)
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	mapper "jaqen/pkgs"
+)
+
+func TestStats_Counts(t *testing.T) {
+	dir := newTestFacepack(t, "| 1 | NGA |  | 3 |\r\n| 2 | NGA |  | 3 |\r\n| 3 | NGA |  | 3 |\r\n",
+		"African/a.png", "African/b.png", "African/c.png", "African/staff/s.png", "Asian/d.png")
+	writeTestFile(t, filepath.Join(dir, "config.xml"), []byte(testConfigXML("1", "faces/African/a")))
+	writeTestFile(t, filepath.Join(dir, "staff.rtf"), []byte("| UID | Nat | 2nd Nat | Job | Ethnicity |\r\n| 4 | NGA |  | Coach | 3 |\r\n"))
+
+	output, run := jsonResult(t, dir, "stats", "--img=faces", "--preserve", "--staff_rtf=staff.rtf")
+	if run.exitCode != 0 {
+		t.Fatalf("expected stats to succeed, got %d: %s", run.exitCode, run.stdout)
+	}
+	var stats statsResult
+	decodeData(t, output, &stats)
+
+	capacities := make(map[mapper.Ethnic]ethnicCapacity)
+	for _, capacity := range stats.Ethnicities {
+		capacities[capacity.Ethnic] = capacity
+	}
+
+	// player 1 keeps African/a, the other players and the coach need an image
+	expected := ethnicCapacity{Ethnic: mapper.African, Players: 3, Staff: 1, Demand: 3, StaffDemand: 1, Images: 4, StaffImages: 1, Available: 3, StaffAvailable: 1}
+	if capacities[mapper.African] != expected {
+		t.Fatalf("expected African counts %+v, got %+v", expected, capacities[mapper.African])
+	}
+	expected = ethnicCapacity{Ethnic: mapper.Asian, Images: 1, Available: 1}
+	if capacities[mapper.Asian] != expected {
+		t.Fatalf("expected Asian counts %+v, got %+v", expected, capacities[mapper.Asian])
+	}
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	mapper "jaqen/pkgs"
+)
+
+type assignmentKind string
+
+const (
+	assignmentNew        assignmentKind = "new"
+	assignmentPreserved  assignmentKind = "preserved"
+	assignmentReassigned assignmentKind = "reassigned"
+	assignmentPinned     assignmentKind = "pinned"
+	assignmentSkipped    assignmentKind = "skipped"
+)
+
+var assignmentKinds = [...]assignmentKind{
+	assignmentNew,
+	assignmentPreserved,
+	assignmentReassigned,
+	assignmentPinned,
+	assignmentSkipped,
+}
+
+type assignment struct {
+	Person   mapper.Person
+	Image    mapper.FilePath
+	Kind     assignmentKind
+	Fallback string // how the image was chosen when the player's ethnic ran out
+}
+
+type runSummary struct {
+	assignments []assignment
+}
+
+func (s *runSummary) add(player mapper.Person, image mapper.FilePath, kind assignmentKind) {
+	s.addFallback(player, image, kind, "")
+}
+
+func (s *runSummary) addFallback(player mapper.Person, image mapper.FilePath, kind assignmentKind, fallback string) {
+	s.assignments = append(s.assignments, assignment{player, image, kind, fallback})
+}
+
+func (s *runSummary) addSkipped(player mapper.Person, reason error) {
+	s.addFallback(player, "", assignmentSkipped, reason.Error())
+}
+
+func (s *runSummary) fallbacks() []assignment {
+	fallbacks := make([]assignment, 0)
+	for _, a := range s.assignments {
+		if a.Fallback != "" {
+			fallbacks = append(fallbacks, a)
+		}
+	}
+	return fallbacks
+}
+
+// printFallbacks lists the players that used a fallback or were skipped
+func (s *runSummary) printFallbacks(w io.Writer) {
+	fallbacks := s.fallbacks()
+	if len(fallbacks) == 0 {
+		return
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "UID\tETHNIC\tFALLBACK\tIMAGE")
+	for _, a := range fallbacks {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", a.Person.ID, a.Person.Ethnic, a.Fallback, a.Image)
+	}
+	table.Flush()
+}
+
+func (s *runSummary) countsPerEthnic() (map[mapper.Ethnic]map[assignmentKind]int, []mapper.Ethnic) {
+	counts := make(map[mapper.Ethnic]map[assignmentKind]int)
+	for _, a := range s.assignments {
+		if _, ok := counts[a.Person.Ethnic]; !ok {
+			counts[a.Person.Ethnic] = make(map[assignmentKind]int)
+		}
+		counts[a.Person.Ethnic][a.Kind]++
+	}
+
+	ethnics := make([]mapper.Ethnic, 0, len(counts))
+	for ethnic := range counts {
+		ethnics = append(ethnics, ethnic)
+	}
+	sort.Slice(ethnics, func(i, j int) bool { return ethnics[i] < ethnics[j] })
+
+	return counts, ethnics
+}
+
+func (s *runSummary) print(w io.Writer, listAssignments bool) {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	if listAssignments {
+		fmt.Fprintln(table, "UID\tETHNIC\tSTATUS\tIMAGE")
+		for _, a := range s.assignments {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", a.Person.ID, a.Person.Ethnic, a.Kind, a.Image)
+		}
+		fmt.Fprintln(table)
+	}
+
+	counts, ethnics := s.countsPerEthnic()
+	totals := make(map[assignmentKind]int)
+
+	fmt.Fprintln(table, "ETHNIC\tNEW\tPRESERVED\tREASSIGNED\tPINNED\tSKIPPED")
+	for _, ethnic := range ethnics {
+		fmt.Fprintf(table, "%s", ethnic)
+		for _, kind := range assignmentKinds {
+			fmt.Fprintf(table, "\t%d", counts[ethnic][kind])
+			totals[kind] += counts[ethnic][kind]
+		}
+		fmt.Fprintln(table)
+	}
+	fmt.Fprintf(table, "Total")
+	for _, kind := range assignmentKinds {
+		fmt.Fprintf(table, "\t%d", totals[kind])
+	}
+	fmt.Fprintln(table)
+
+	table.Flush()
+
+	if len(s.fallbacks()) > 0 {
+		fmt.Fprintln(w)
+		s.printFallbacks(w)
+	}
+}
+
+// printOverrideStubs lists the [mapping_override] entries that a dry run with
+// --suggest_overrides would have added to the config file
+func printOverrideStubs(w io.Writer) {
+	if len(result.OverrideStubs) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nwould add %d commented out [mapping_override] entries to %s:\n", len(result.OverrideStubs), configPath)
+	for _, stub := range result.OverrideStubs {
+		fmt.Fprintln(w, stub)
+	}
+}
@@ -1,11 +1,23 @@
 package internal
 
 const (
-	DefaultPreserve       = false
-	DefaultXMLPath        = "./config.xml"
-	DefaultRTFPath        = "./newgen.rtf"
-	DefaultImagesPath     = "./"
-	DefaultFMVersion      = "2024"
-	DefaultConfigPath     = "./jaqen.toml"
-	DefaultAllowDuplicate = false
+	DefaultPreserve        = false
+	DefaultXMLPath         = "./config.xml"
+	DefaultRTFPath         = "./newgen.rtf"
+	DefaultImagesPath      = "./"
+	DefaultFMVersion       = "2024"
+	DefaultConfigPath      = "./jaqen.toml"
+	DefaultAllowDuplicate  = false
+	DefaultBackupCount     = 5
+	DefaultStableHash      = false
+	DefaultBalanced        = false
+	DefaultRecursive       = false
+	DefaultValidation      = "header"
+	DefaultDedupe          = false
+	DefaultDedupeThreshold = 5
+	DefaultLayerPriority   = 1 // above the image directory
+	DefaultUnknownNation   = "fail"
 )
+
+// extensions of the image files that end up in the pool
+var DefaultImageExtensions = []string{"png", "jpg", "jpeg"}
@@ -1,11 +1,50 @@
 package internal
 
+type EthnicRule struct {
+	EthnicValue  []int    `field:"ethnic_value" toml:"ethnic_value,omitempty"`
+	Nationality1 []string `field:"nationality1" toml:"nationality1,omitempty"`
+	Nationality2 []string `field:"nationality2" toml:"nationality2,omitempty"`
+	Ethnic1      []string `field:"ethnic1" toml:"ethnic1,omitempty"`
+	Ethnic2      []string `field:"ethnic2" toml:"ethnic2,omitempty"`
+	AnyEthnic    []string `field:"any_ethnic" toml:"any_ethnic,omitempty"`
+	Use          string   `field:"use" toml:"use"`
+}
+
+type FallbackPolicy struct {
+	Ethnics []string `field:"ethnics" toml:"ethnics,omitempty"`
+	Policy  string   `field:"policy" toml:"policy,omitempty"`
+}
+
+type ImageLayer struct {
+	Path     string `field:"path" toml:"path"`
+	Priority *int   `field:"priority" toml:"priority,omitempty"`
+}
+
 type JaqenConfig struct {
-	Preserve        *bool              `field:"preserve" toml:"preserve"`
-	XMLPath         *string            `field:"xml_path" toml:"xml_path"`
-	RTFPath         *string            `field:"rtf_path" toml:"rtf_path"`
-	IMGPath         *string            `field:"img_path" toml:"img_path"`
-	FMVersion       *string            `field:"fm_version" toml:"fm_version"`
-	AllowDuplicate  *bool              `field:"allow_duplicate" toml:"allow_duplicate"`
-	MappingOverride *map[string]string `field:"mapping_override" toml:"mapping_override"`
+	Preserve        *bool                      `field:"preserve" toml:"preserve"`
+	XMLPath         *string                    `field:"xml_path" toml:"xml_path"`
+	RTFPath         *string                    `field:"rtf_path" toml:"rtf_path"`
+	StaffRTFPath    *string                    `field:"staff_rtf_path" toml:"staff_rtf_path"`
+	IMGPath         *string                    `field:"img_path" toml:"img_path"`
+	FMVersion       *string                    `field:"fm_version" toml:"fm_version"`
+	AllowDuplicate  *bool                      `field:"allow_duplicate" toml:"allow_duplicate"`
+	BackupCount     *int                       `field:"backup_count" toml:"backup_count"`
+	Seed            *int64                     `field:"seed" toml:"seed"`
+	StableHash      *bool                      `field:"stable_hash" toml:"stable_hash"`
+	Balanced        *bool                      `field:"balanced" toml:"balanced"`
+	Recursive       *bool                      `field:"recursive" toml:"recursive"`
+	ImageInclude    *[]string                  `field:"image_include" toml:"image_include"`
+	ImageExclude    *[]string                  `field:"image_exclude" toml:"image_exclude"`
+	ImageExtensions *[]string                  `field:"image_extensions" toml:"image_extensions"`
+	ImageValidation *string                    `field:"image_validation" toml:"image_validation"`
+	Dedupe          *bool                      `field:"dedupe" toml:"dedupe"`
+	Ethnicities     *[]string                  `field:"ethnicities" toml:"ethnicities"`
+	UnknownNation   *string                    `field:"unknown_nationality" toml:"unknown_nationality"`
+	DefaultEthnic   *string                    `field:"default_ethnic" toml:"default_ethnic"`
+	GameDate        *string                    `field:"game_date" toml:"game_date"`
+	MappingOverride *map[string]string         `field:"mapping_override" toml:"mapping_override"`
+	PlayerOverride  *map[string]string         `field:"player_override" toml:"player_override"`
+	Fallback        *map[string]FallbackPolicy `field:"fallback" toml:"fallback"`
+	EthnicRules     []EthnicRule               `field:"ethnic_rule" toml:"ethnic_rule,omitempty"` // a pointer would be marshalled inline
+	ImageLayers     []ImageLayer               `field:"image_layer" toml:"image_layer,omitempty"`
 }
@@ -1,9 +1,13 @@
 package internal
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -68,3 +72,138 @@ func WriteConfig(config JaqenConfig, filePath string) error {
 
 	return nil
 }
+
+// WriteFileAtomic writes to a temporary file in the same directory and
+// renames it over filePath, so a failed write never leaves a truncated file
+func WriteFileAtomic(filePath string, data []byte) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+"-*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if info, err := os.Stat(filePath); err == nil {
+		os.Chmod(tempPath, info.Mode().Perm())
+	}
+
+	if err := os.Rename(tempPath, filePath); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return nil
+}
+
+type MappingOverrideStub struct {
+	Nation  string `json:"nation"`
+	Ethnic  string `json:"ethnic"` // suggested ethnic, can be empty
+	Comment string `json:"comment"`
+}
+
+func (stub MappingOverrideStub) String() string {
+	return fmt.Sprintf("# %s = '%s' # %s", stub.Nation, stub.Ethnic, stub.Comment)
+}
+
+var (
+	mappingOverrideHeaderRegex = regexp.MustCompile(`(?m)^[ \t]*\[mapping_override\][ \t]*(#.*)?$`)
+	tableHeaderRegex           = regexp.MustCompile(`(?m)^[ \t]*\[`)
+)
+
+// newMappingOverrideStubs returns the stubs for nations that are not in the
+// [mapping_override] table of the config, commented out or not
+func newMappingOverrideStubs(config string, stubs []MappingOverrideStub) []MappingOverrideStub {
+	// only the keys of the [mapping_override] table, up to the next table
+	section := ""
+	if header := mappingOverrideHeaderRegex.FindStringIndex(config); header != nil {
+		section = config[header[1]:]
+		if next := tableHeaderRegex.FindStringIndex(section); next != nil {
+			section = section[:next[0]]
+		}
+	}
+
+	newStubs := make([]MappingOverrideStub, 0, len(stubs))
+	for _, stub := range stubs {
+		existing := regexp.MustCompile(`(?m)^[ \t]*#?[ \t]*` + regexp.QuoteMeta(stub.Nation) + `[ \t]*=`)
+		if !existing.MatchString(section) {
+			newStubs = append(newStubs, stub)
+		}
+	}
+	return newStubs
+}
+
+func readConfigText(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// NewMappingOverrideStubs returns the stubs that AddMappingOverrideStubs would
+// add to the config file, without writing it
+func NewMappingOverrideStubs(filePath string, stubs []MappingOverrideStub) ([]MappingOverrideStub, error) {
+	config, err := readConfigText(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return newMappingOverrideStubs(config, stubs), nil
+}
+
+// AddMappingOverrideStubs writes commented out [mapping_override] entries to
+// the config file, for nations that are not in it yet. The file is edited as
+// text so that its comments and layout are kept. It returns the number of
+// stubs that were added.
+func AddMappingOverrideStubs(filePath string, stubs []MappingOverrideStub) (int, error) {
+	config, err := readConfigText(filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	newStubs := newMappingOverrideStubs(config, stubs)
+	if len(newStubs) == 0 {
+		return 0, nil
+	}
+	lines := make([]string, len(newStubs))
+	for i, stub := range newStubs {
+		lines[i] = stub.String()
+	}
+
+	if header := mappingOverrideHeaderRegex.FindStringIndex(config); header != nil {
+		rest := config[header[1]:]
+		if rest == "" {
+			rest = "\n"
+		}
+		config = config[:header[1]] + "\n" + strings.Join(lines, "\n") + rest
+	} else {
+		if config != "" && !strings.HasSuffix(config, "\n") {
+			config += "\n"
+		}
+		if config != "" {
+			config += "\n"
+		}
+		config += "[mapping_override]\n" + strings.Join(lines, "\n") + "\n"
+	}
+
+	if err := WriteFileAtomic(filePath, []byte(config)); err != nil {
+		return 0, err
+	}
+
+	return len(lines), nil
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "jaqen.toml")
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("could not write config file: %v", err)
+	}
+	return configPath
+}
+
+func addStubs(t *testing.T, configPath string, expectedAdded int) string {
+	t.Helper()
+
+	added, err := AddMappingOverrideStubs(configPath, []MappingOverrideStub{
+		{Nation: "XYZ", Ethnic: "African", Comment: "Xyzland"},
+		{Nation: "ABC", Ethnic: "", Comment: "Abcland"},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if added != expectedAdded {
+		t.Fatalf("expected %d stubs to be added, got %d", expectedAdded, added)
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("could not read config file: %v", err)
+	}
+	return string(content)
+}
+
+func TestAddMappingOverrideStubs_HeaderPresent(t *testing.T) {
+	configPath := writeConfigFile(t, "preserve = true\n\n[mapping_override]\nENG = 'Caucasian'\n\n[[image_layer]]\npath = 'addon'\n")
+
+	expected := "preserve = true\n\n[mapping_override]\n" +
+		"# XYZ = 'African' # Xyzland\n" +
+		"# ABC = '' # Abcland\n" +
+		"ENG = 'Caucasian'\n\n[[image_layer]]\npath = 'addon'\n"
+	if content := addStubs(t, configPath, 2); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestAddMappingOverrideStubs_HeaderAbsent(t *testing.T) {
+	configPath := writeConfigFile(t, "preserve = true")
+
+	expected := "preserve = true\n\n[mapping_override]\n" +
+		"# XYZ = 'African' # Xyzland\n" +
+		"# ABC = '' # Abcland\n"
+	if content := addStubs(t, configPath, 2); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestAddMappingOverrideStubs_HeaderAtEndWithoutNewline(t *testing.T) {
+	configPath := writeConfigFile(t, "preserve = true\n[mapping_override]")
+
+	expected := "preserve = true\n[mapping_override]\n" +
+		"# XYZ = 'African' # Xyzland\n" +
+		"# ABC = '' # Abcland\n"
+	if content := addStubs(t, configPath, 2); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestAddMappingOverrideStubs_KeyAlreadyPresent(t *testing.T) {
+	// XYZ is a key of another table, only the commented out ABC counts
+	configPath := writeConfigFile(t, "[player_override]\nXYZ = 'x'\n\n[mapping_override]\n# ABC = 'Asian'\n")
+
+	expected := "[player_override]\nXYZ = 'x'\n\n[mapping_override]\n" +
+		"# XYZ = 'African' # Xyzland\n" +
+		"# ABC = 'Asian'\n"
+	if content := addStubs(t, configPath, 1); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	// running it again adds nothing
+	if content := addStubs(t, configPath, 0); content != expected {
+		t.Fatalf("expected an unchanged file, got:\n%s", content)
+	}
+}
@@ -0,0 +1,120 @@
+package mapper
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// age bands are subfolders or filename tags with the ages an image suits,
+// ex: African/age16-21/image, African/image_age30+ or African/1-5/age22-29
+var (
+	ageBandFolderRegex = regexp.MustCompile(`(?i)^age[ _-]?(\d+)(?:-(\d+)|(\+))?$`)
+	ageBandTagRegex    = regexp.MustCompile(`(?i)(?:^|[ _.-])age[ _-]?(\d+)(?:-(\d+)|(\+))?(?:$|[ _.-])`)
+)
+
+type ageBand struct {
+	min int
+	max int
+}
+
+func (band *ageBand) contains(age int) bool {
+	return band != nil && band.min <= age && age <= band.max
+}
+
+func ageBandOfMatches(matches []string) *ageBand {
+	min, _ := strconv.Atoi(matches[1])
+	max := min
+	switch {
+	case matches[2] != "":
+		max, _ = strconv.Atoi(matches[2])
+	case matches[3] != "":
+		max = math.MaxInt
+	}
+	if max < min {
+		min, max = max, min
+	}
+
+	return &ageBand{min, max}
+}
+
+func parseAgeBandFolder(folderName string) *ageBand {
+	matches := ageBandFolderRegex.FindStringSubmatch(folderName)
+	if matches == nil {
+		return nil
+	}
+	return ageBandOfMatches(matches)
+}
+
+// ageBandOfImage returns the age band tagged in the filename of an image, or
+// the one of its innermost age band folder
+func ageBandOfImage(relativePath string) *ageBand {
+	stem := strings.TrimSuffix(path.Base(relativePath), path.Ext(relativePath))
+	if matches := ageBandTagRegex.FindStringSubmatch(stem); matches != nil {
+		return ageBandOfMatches(matches)
+	}
+
+	folders := strings.Split(path.Dir(relativePath), "/")
+	for i := len(folders) - 1; i >= 0; i-- {
+		if band := parseAgeBandFolder(folders[i]); band != nil {
+			return band
+		}
+	}
+	return nil
+}
+
+var (
+	ageNumberRegex   = regexp.MustCompile(`^\d+$`)
+	ageYearsOldRegex = regexp.MustCompile(`(?i)(\d+) years? old`)
+)
+
+// dates the way the game exports them, day first, 3/4/2006 is the 3rd of
+// April. The month first dates of a US locale are not supported.
+var dateLayouts = []string{"2/1/2006", "2.1.2006", "2-1-2006", "2006-01-02"}
+
+// ParseDate reads a date in one of the formats of the game, ex: 15/6/2030 or
+// 2030-06-15
+func ParseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf(`"%s" is not a date, use day/month/year or year-month-day`, value)
+}
+
+// parseAge reads an age column, or a date of birth column. A date of birth
+// of the game usually comes with the age, ex: 12/3/2006 (19 years old), when
+// it does not the age is counted at the given date, and counted is true. A
+// counted age is 0 or less when the date is not after the date of birth.
+func parseAge(value string, date time.Time) (age int, counted bool, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false, nil
+	}
+
+	if ageNumberRegex.MatchString(value) {
+		age, err = strconv.Atoi(value)
+		return age, false, err
+	}
+	if matches := ageYearsOldRegex.FindStringSubmatch(value); matches != nil {
+		age, err = strconv.Atoi(matches[1])
+		return age, false, err
+	}
+
+	born, err := ParseDate(strings.SplitN(value, "(", 2)[0])
+	if err != nil {
+		return 0, false, fmt.Errorf("%q is neither an age nor a date of birth", value)
+	}
+
+	age = date.Year() - born.Year()
+	if date.Month() < born.Month() || (date.Month() == born.Month() && date.Day() < born.Day()) {
+		age-- // no birthday yet this year
+	}
+	return age, true, nil
+}
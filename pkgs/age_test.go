@@ -0,0 +1,117 @@
+package mapper
+
+import (
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseAge_AgeAndDateOfBirth(t *testing.T) {
+	date := time.Date(2030, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		age     int
+		counted bool
+	}{
+		"":                         {0, false},
+		"19":                       {19, false},
+		"12/3/2006 (24 years old)": {24, false},
+		"16/6/2010":                {19, true},
+		"15/6/2010":                {20, true},
+		"2010-06-14":               {20, true},
+		"16/6/2030":                {-1, true},
+	}
+
+	for value, expected := range cases {
+		age, counted, err := parseAge(value, date)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", value, err)
+		}
+		if age != expected.age || counted != expected.counted {
+			t.Fatalf("expected %q to be %d (counted: %t), got %d (counted: %t)", value, expected.age, expected.counted, age, counted)
+		}
+	}
+
+	for _, value := range []string{"young", "6/13/2010"} {
+		if _, _, err := parseAge(value, date); err == nil {
+			t.Fatalf("expected an error for %q but got none", value)
+		}
+	}
+}
+
+func TestParseDate_DayFirst(t *testing.T) {
+	// 3/4/2006 is the 3rd of April, never the 4th of March
+	date, err := ParseDate("3/4/2006")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if date.Day() != 3 || date.Month() != time.April {
+		t.Fatalf("expected the 3rd of April, got %s", date.Format("2 January"))
+	}
+
+	age, _, err := parseAge("3/4/2006", time.Date(2030, time.March, 20, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if age != 23 {
+		t.Fatalf("expected 23 before the birthday of April, got %d", age)
+	}
+}
+
+func TestAgeBandOfImage_FolderAndTag(t *testing.T) {
+	cases := map[string]*ageBand{
+		"face.png":                  nil,
+		"page1.png":                 nil,
+		"age16-21/face.png":         {16, 21},
+		"1-5/AGE_22-29/face.png":    {22, 29},
+		"age16-21/face_age30+.png":  {30, math.MaxInt},
+		"batch/face-age35-40-1.png": {35, 40},
+	}
+
+	for relativePath, expected := range cases {
+		band := ageBandOfImage(relativePath)
+		if (band == nil) != (expected == nil) || (band != nil && *band != *expected) {
+			t.Fatalf("expected %q to have age band %v, got %v", relativePath, expected, band)
+		}
+	}
+}
+
+func TestScanEthnicFolder_AgeBandFolders(t *testing.T) {
+	paths := scannedPaths(t, ImagePoolOptions{}, "a.png", "age16-21/b.png", "1-5/age30+/c.png", "staff/age40-50/d.png", "old/e.png")
+
+	expected := []FilePath{"1-5/age30+/c", "a", "age16-21/b", "staff/age40-50/d"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestGetRandomImagePath_AgeBand(t *testing.T) {
+	imagePool := newTestImagePool(t,
+		"African/age16-21/young.png",
+		"African/old_age30+.png",
+		"African/1-5/light.png",
+		"African/1-5/age16-21/light_young.png",
+	)
+
+	filename, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, Age: 17, SkinTone: 3}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "1-5/age16-21/light_young" {
+		t.Fatalf("expected the image matching skin tone and age, got %q", filename)
+	}
+
+	filename, err = imagePool.GetRandomImagePath(Person{ID: "2", Ethnic: African, Age: 35}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "old_age30+" {
+		t.Fatalf("expected the image of the age band, got %q", filename)
+	}
+
+	// no image of the age band is left, any image of the ethnic will do
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "3", Ethnic: African, Age: 40}, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
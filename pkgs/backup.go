@@ -0,0 +1,135 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	internal "jaqen/internal"
+)
+
+const (
+	backupTimeFormat = "20060102-150405.000000"
+	backupExtension  = ".bak"
+)
+
+type Backup struct {
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// backups sit next to the xml file, ex: config.xml.20240101-120000.000000.bak
+func backupPrefix(xmlPath string) string {
+	return filepath.Base(xmlPath) + "."
+}
+
+func ListBackups(xmlPath string) ([]Backup, error) {
+	files, err := os.ReadDir(filepath.Dir(xmlPath))
+	if err != nil {
+		return nil, errors.Join(errors.New("cannot read backup directory"), err)
+	}
+
+	prefix := backupPrefix(xmlPath)
+	backups := make([]Backup, 0)
+
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, backupExtension) {
+			continue
+		}
+
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), backupExtension)
+		createdAt, err := time.ParseInLocation(backupTimeFormat, timestamp, time.Local)
+		if err != nil {
+			continue // not one of ours
+		}
+
+		backups = append(backups, Backup{
+			Path:      filepath.Join(filepath.Dir(xmlPath), name),
+			CreatedAt: createdAt,
+		})
+	}
+
+	// newest first
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// BackupXML copies the xml file to a timestamped backup and removes the
+// oldest backups so that at most keep of them are left. A keep of 0 disables
+// backups.
+func BackupXML(xmlPath string, keep int) (string, error) {
+	return backupXML(xmlPath, keep, "")
+}
+
+// backupXML is BackupXML that never removes the backup at spare, which is the
+// one being restored
+func backupXML(xmlPath string, keep int, spare string) (string, error) {
+	if keep <= 0 {
+		return "", nil
+	}
+
+	xmlBytes, err := os.ReadFile(xmlPath)
+	if err != nil {
+		return "", errors.Join(errors.New("cannot read xml file for backup"), err)
+	}
+
+	backupPath := filepath.Join(
+		filepath.Dir(xmlPath),
+		backupPrefix(xmlPath)+time.Now().Format(backupTimeFormat)+backupExtension,
+	)
+	if err := internal.WriteFileAtomic(backupPath, xmlBytes); err != nil {
+		return "", errors.Join(errors.New("cannot write xml backup"), err)
+	}
+
+	backups, err := ListBackups(xmlPath)
+	if err != nil {
+		return backupPath, err
+	}
+
+	for _, backup := range backups[min(keep, len(backups)):] {
+		if spare != "" && sameFile(backup.Path, spare) {
+			continue
+		}
+		if err := os.Remove(backup.Path); err != nil {
+			return backupPath, fmt.Errorf("cannot remove old backup %s: %w", backup.Path, err)
+		}
+	}
+
+	return backupPath, nil
+}
+
+func sameFile(path1 string, path2 string) bool {
+	info1, err1 := os.Stat(path1)
+	info2, err2 := os.Stat(path2)
+	return err1 == nil && err2 == nil && os.SameFile(info1, info2)
+}
+
+// RestoreBackup replaces the xml file with a backup. The current xml file is
+// backed up first so that a restore can be undone, the restored backup is
+// kept even when it is the oldest one.
+func RestoreBackup(xmlPath string, backupPath string, keep int) error {
+	backupBytes, err := os.ReadFile(backupPath)
+	if err != nil {
+		return errors.Join(errors.New("cannot read backup"), err)
+	}
+
+	if _, err := os.Stat(xmlPath); err == nil {
+		if _, err := backupXML(xmlPath, keep, backupPath); err != nil {
+			return err
+		}
+	}
+
+	if err := internal.WriteFileAtomic(xmlPath, backupBytes); err != nil {
+		return errors.Join(errors.New("cannot restore backup"), err)
+	}
+
+	return nil
+}
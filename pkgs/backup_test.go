@@ -0,0 +1,92 @@
+package mapper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupXML_KeepsNewestBackups(t *testing.T) {
+	xmlPath := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(xmlPath, []byte("<record></record>"), 0o644); err != nil {
+		t.Fatalf("could not write xml file: %v", err)
+	}
+
+	backupPaths := make([]string, 0)
+	for i := 0; i < 3; i++ {
+		backupPath, err := BackupXML(xmlPath, 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		backupPaths = append(backupPaths, backupPath)
+	}
+
+	backups, err := ListBackups(xmlPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+	if backups[0].Path != backupPaths[2] || backups[1].Path != backupPaths[1] {
+		t.Fatalf("expected the newest backups to be kept, got %v", backups)
+	}
+}
+
+func TestRestoreBackup_BacksUpCurrentXML(t *testing.T) {
+	xmlPath := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(xmlPath, []byte("old"), 0o644); err != nil {
+		t.Fatalf("could not write xml file: %v", err)
+	}
+
+	backupPath, err := BackupXML(xmlPath, 5)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if err := os.WriteFile(xmlPath, []byte("new"), 0o644); err != nil {
+		t.Fatalf("could not write xml file: %v", err)
+	}
+
+	if err := RestoreBackup(xmlPath, backupPath, 5); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if content, _ := os.ReadFile(xmlPath); string(content) != "old" {
+		t.Fatalf("expected xml file to be restored, got %q", content)
+	}
+
+	backups, _ := ListBackups(xmlPath)
+	if len(backups) != 2 {
+		t.Fatalf("expected the current xml file to be backed up, got %d backups", len(backups))
+	}
+}
+
+func TestRestoreBackup_OldestBackupIsKept(t *testing.T) {
+	xmlPath := filepath.Join(t.TempDir(), "config.xml")
+
+	backupPaths := make([]string, 0)
+	for _, content := range []string{"first", "second"} {
+		if err := os.WriteFile(xmlPath, []byte(content), 0o644); err != nil {
+			t.Fatalf("could not write xml file: %v", err)
+		}
+		backupPath, err := BackupXML(xmlPath, 2)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		backupPaths = append(backupPaths, backupPath)
+	}
+
+	// the backup of the current file would rotate the oldest backup out
+	if err := RestoreBackup(xmlPath, backupPaths[0], 2); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if content, _ := os.ReadFile(xmlPath); string(content) != "first" {
+		t.Fatalf("expected xml file to be restored, got %q", content)
+	}
+	if content, err := os.ReadFile(backupPaths[0]); err != nil || string(content) != "first" {
+		t.Fatalf("expected the restored backup to be kept, got %q, %v", content, err)
+	}
+}
@@ -21,7 +21,9 @@ const (
 	YugoslavGreek               Ethnic = "YugoGreek"
 )
 
-var Ethnicities = [...]Ethnic{
+// Ethnicities are the ethnic folders of a facepack, custom ones from the
+// config are added with AddEthnicities
+var Ethnicities = []Ethnic{
 	African,
 	Asian,
 	Caucasian,
@@ -0,0 +1,271 @@
+package mapper
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math/bits"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+
+	internal "jaqen/internal"
+)
+
+// DedupeCacheFile is written to the image root by jaqen dedupe
+const DedupeCacheFile = ".jaqen-dedupe.json"
+
+// ImageHash fingerprints one image file of the pool
+type ImageHash struct {
+	Ethnic     Ethnic    `json:"ethnic"`
+	File       string    `json:"file"` // relative to the ethnic folder, with extension
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Content    string    `json:"content"`    // sha256 of the file
+	Perceptual uint64    `json:"perceptual"` // difference hash of the decoded image
+}
+
+// Path is the image path the way it is assigned, ex: African/1-5/image
+func (hash ImageHash) Path() FilePath {
+	return FilePath(path.Join(string(hash.Ethnic), hash.File[:len(hash.File)-len(path.Ext(hash.File))]))
+}
+
+// DuplicateCluster groups images that show the same face. A cluster is exact
+// when every file has the same content.
+type DuplicateCluster struct {
+	Exact  bool       `json:"exact"`
+	Images []FilePath `json:"images"`
+}
+
+type DedupeCache struct {
+	Threshold int                `json:"threshold"`
+	Hashes    []ImageHash        `json:"hashes"`
+	Clusters  []DuplicateCluster `json:"clusters"`
+}
+
+// ReadDedupeCache reads the results of the last jaqen dedupe run, it returns
+// nil when there are none
+func ReadDedupeCache(imageRootPath string) (*DedupeCache, error) {
+	cacheBytes, err := os.ReadFile(filepath.Join(imageRootPath, DedupeCacheFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Join(errors.New("cannot read dedupe results"), err)
+	}
+
+	var cache DedupeCache
+	if err := json.Unmarshal(cacheBytes, &cache); err != nil {
+		return nil, errors.Join(errors.New("cannot parse dedupe results"), err)
+	}
+
+	return &cache, nil
+}
+
+func WriteDedupeCache(imageRootPath string, cache *DedupeCache) error {
+	cacheBytes, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := internal.WriteFileAtomic(filepath.Join(imageRootPath, DedupeCacheFile), cacheBytes); err != nil {
+		return errors.Join(errors.New("cannot write dedupe results"), err)
+	}
+
+	return nil
+}
+
+// differenceHash shrinks the image to 9x8 gray pixels and sets a bit for each
+// pixel that is brighter than its right neighbour. Re-encoded or resized
+// copies of an image end up with the same or a very close hash.
+func differenceHash(img image.Image) uint64 {
+	const width, height = 9, 8
+
+	bounds := img.Bounds()
+	var gray [height][width]float64
+
+	for y := 0; y < height; y++ {
+		minY := bounds.Min.Y + y*bounds.Dy()/height
+		maxY := max(bounds.Min.Y+(y+1)*bounds.Dy()/height, minY+1)
+
+		for x := 0; x < width; x++ {
+			minX := bounds.Min.X + x*bounds.Dx()/width
+			maxX := max(bounds.Min.X+(x+1)*bounds.Dx()/width, minX+1)
+
+			var sum float64
+			var count int
+			for py := minY; py < maxY && py < bounds.Max.Y; py++ {
+				for px := minX; px < maxX && px < bounds.Max.X; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count++
+				}
+			}
+			if count > 0 {
+				gray[y][x] = sum / float64(count)
+			}
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width-1; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+func hashImageFile(filePath string) (string, uint64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	contentHash := sha256.New()
+	img, _, err := image.Decode(io.TeeReader(file, contentHash))
+	if err != nil {
+		return "", 0, err
+	}
+	// the decoder may stop before the end of the file
+	if _, err := io.Copy(contentHash, file); err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(contentHash.Sum(nil)), differenceHash(img), nil
+}
+
+// HashImages fingerprints every image of the pool. Hashes of the previous
+// run are reused for files that have not changed since.
+func (images *ImagePool) HashImages(previous *DedupeCache) ([]ImageHash, error) {
+	cached := make(map[string]ImageHash)
+	if previous != nil {
+		for _, hash := range previous.Hashes {
+			cached[path.Join(string(hash.Ethnic), hash.File)] = hash
+		}
+	}
+
+	hashes := make([]ImageHash, 0)
+	hashErrors := []error{}
+
+	for _, ethnic := range Ethnicities {
+		for _, poolImage := range images.images[ethnic] {
+			filePath := filepath.Join(images.roots[poolImage.root].Path, string(ethnic), filepath.FromSlash(poolImage.file))
+
+			info, err := os.Stat(filePath)
+			if err != nil {
+				hashErrors = append(hashErrors, err)
+				continue
+			}
+
+			hash, ok := cached[path.Join(string(ethnic), poolImage.file)]
+			if !ok || hash.Size != info.Size() || !hash.ModTime.Equal(info.ModTime()) {
+				content, perceptual, err := hashImageFile(filePath)
+				if err != nil {
+					hashErrors = append(hashErrors, fmt.Errorf("cannot hash image %s: %w", filePath, err))
+					continue
+				}
+
+				hash = ImageHash{
+					Ethnic:     ethnic,
+					File:       poolImage.file,
+					Size:       info.Size(),
+					ModTime:    info.ModTime(),
+					Content:    content,
+					Perceptual: perceptual,
+				}
+			}
+
+			hashes = append(hashes, hash)
+		}
+	}
+
+	return hashes, errors.Join(hashErrors...)
+}
+
+// FindDuplicates clusters images with the same content or with perceptual
+// hashes that differ in at most threshold of their 64 bits. Images are only
+// compared with the first image of a cluster, in path order, so that a chain
+// of small differences does not join images that look nothing alike.
+func FindDuplicates(hashes []ImageHash, threshold int) []DuplicateCluster {
+	sorted := slices.Clone(hashes)
+	slices.SortFunc(sorted, func(a, b ImageHash) int {
+		return cmp.Compare(a.Path(), b.Path())
+	})
+
+	members := make([][]ImageHash, 0)
+	for _, hash := range sorted {
+		found := false
+		for i, cluster := range members {
+			representative := cluster[0]
+			if hash.Content == representative.Content ||
+				bits.OnesCount64(hash.Perceptual^representative.Perceptual) <= threshold {
+				members[i] = append(cluster, hash)
+				found = true
+				break
+			}
+		}
+		if !found {
+			members = append(members, []ImageHash{hash})
+		}
+	}
+
+	clusters := make([]DuplicateCluster, 0)
+	for _, cluster := range members {
+		if len(cluster) < 2 {
+			continue
+		}
+
+		duplicates := DuplicateCluster{Exact: true}
+		for _, hash := range cluster {
+			if hash.Content != cluster[0].Content {
+				duplicates.Exact = false
+			}
+			duplicates.Images = append(duplicates.Images, hash.Path())
+		}
+		clusters = append(clusters, duplicates)
+	}
+
+	return clusters
+}
+
+// UseDuplicateClusters makes every image of a cluster leave the pool as soon
+// as one of them is assigned or excluded, as if the cluster was one image
+func (images *ImagePool) UseDuplicateClusters(clusters []DuplicateCluster) {
+	images.siblings = make(map[FilePath][]FilePath)
+
+	for _, cluster := range clusters {
+		for _, image := range cluster.Images {
+			for _, sibling := range cluster.Images {
+				if sibling != image {
+					images.siblings[image] = append(images.siblings[image], sibling)
+				}
+			}
+		}
+	}
+}
+
+// removeSiblings takes the duplicates of an image out of the pool
+func (images *ImagePool) removeSiblings(ethnic Ethnic, imagePath FilePath) {
+	for _, sibling := range images.siblings[FilePath(path.Join(string(ethnic), string(imagePath)))] {
+		siblingEthnic, siblingPath, ok := SplitEthnicImagePath(sibling)
+		if !ok {
+			continue
+		}
+
+		images.pool[siblingEthnic] = slices.DeleteFunc(images.pool[siblingEthnic], func(image poolImage) bool {
+			return image.path == siblingPath
+		})
+	}
+}
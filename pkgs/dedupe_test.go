@@ -0,0 +1,140 @@
+package mapper
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func gradientImage(size int, reverse bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			value := x * 255 / size
+			if reverse {
+				value = 255 - value
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(value)})
+		}
+	}
+	return img
+}
+
+func writeImageFile(t *testing.T, filePath string, img image.Image) {
+	t.Helper()
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		t.Fatalf("could not create image: %v", err)
+	}
+	defer file.Close()
+
+	if filepath.Ext(filePath) == ".jpg" {
+		err = jpeg.Encode(file, img, nil)
+	} else {
+		err = png.Encode(file, img)
+	}
+	if err != nil {
+		t.Fatalf("could not encode image: %v", err)
+	}
+}
+
+func TestFindDuplicates_ExactAndNear(t *testing.T) {
+	imagePool := newTestImagePool(t)
+	writeImageFile(t, filepath.Join(imagePool.roots[0].Path, "African", "a.png"), gradientImage(64, false))
+	writeImageFile(t, filepath.Join(imagePool.roots[0].Path, "Asian", "b.png"), gradientImage(64, false))
+	writeImageFile(t, filepath.Join(imagePool.roots[0].Path, "Caucasian", "c.jpg"), gradientImage(128, false))
+	writeImageFile(t, filepath.Join(imagePool.roots[0].Path, "African", "d.png"), gradientImage(64, true))
+
+	imagePool, err := NewImagePool(imagePool.roots[0].Path, ImagePoolOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	hashes, err := imagePool.HashImages(nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	clusters := FindDuplicates(hashes, 5)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %v", clusters)
+	}
+
+	expected := []FilePath{"African/a", "Asian/b", "Caucasian/c"}
+	if !slices.Equal(clusters[0].Images, expected) {
+		t.Fatalf("expected %v, got %v", expected, clusters[0].Images)
+	}
+	if clusters[0].Exact {
+		t.Fatal("expected a near duplicate cluster")
+	}
+}
+
+func TestFindDuplicates_NoChaining(t *testing.T) {
+	hashes := []ImageHash{
+		{Ethnic: African, File: "c.png", Content: "c", Perceptual: 0b111111},
+		{Ethnic: African, File: "a.png", Content: "a", Perceptual: 0},
+		{Ethnic: African, File: "b.png", Content: "b", Perceptual: 0b111},
+	}
+
+	// b is near a and near c, but a and c differ in 6 bits
+	clusters := FindDuplicates(hashes, 3)
+	if len(clusters) != 1 {
+		t.Fatalf("expected 1 cluster, got %v", clusters)
+	}
+
+	expected := []FilePath{"African/a", "African/b"}
+	if !slices.Equal(clusters[0].Images, expected) {
+		t.Fatalf("expected %v, got %v", expected, clusters[0].Images)
+	}
+}
+
+func TestDedupeCache_RoundTrip(t *testing.T) {
+	root := t.TempDir()
+
+	cache, err := ReadDedupeCache(root)
+	if err != nil || cache != nil {
+		t.Fatalf("expected no cache and no error, got %v, %v", cache, err)
+	}
+
+	written := &DedupeCache{
+		Threshold: 5,
+		Clusters:  []DuplicateCluster{{Exact: true, Images: []FilePath{"African/a", "Asian/b"}}},
+	}
+	if err := WriteDedupeCache(root, written); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	cache, err = ReadDedupeCache(root)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(cache.Clusters) != 1 || !slices.Equal(cache.Clusters[0].Images, written.Clusters[0].Images) {
+		t.Fatalf("expected %v, got %v", written.Clusters, cache.Clusters)
+	}
+}
+
+func TestUseDuplicateClusters_ClusterIsOneImage(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/a.png", "African/b.png", "Asian/c.png", "Asian/d.png")
+	imagePool.UseDuplicateClusters([]DuplicateCluster{{Images: []FilePath{"African/a", "Asian/c"}}})
+
+	if err := imagePool.ExcludeImages([]FilePath{"img/African/a"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if available := imagePool.Available(Asian); available != 1 {
+		t.Fatalf("expected the duplicate in Asian to be excluded, got %d available", available)
+	}
+
+	imagePool.UseDuplicateClusters([]DuplicateCluster{{Images: []FilePath{"African/b", "Asian/d"}}})
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African}, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if available := imagePool.Available(Asian); available != 0 {
+		t.Fatalf("expected the duplicate in Asian to leave the pool, got %d available", available)
+	}
+}
@@ -0,0 +1,144 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	// used as an EthnicRule result to take the ethnic of a player's nationality
+	FirstNationalityEthnic  Ethnic = "first_nationality"
+	SecondNationalityEthnic Ethnic = "second_nationality"
+
+	minEthnicValue = 0
+	maxEthnicValue = 10
+)
+
+// EthnicRule resolves the ethnic of a player from the ethnic value in the RTF
+// (0-10) and their nationalities. Every non-empty condition has to match for
+// the rule to apply, an empty condition matches anything.
+type EthnicRule struct {
+	EthnicValues []int    // ethnic value from the RTF
+	Nationality1 []string // country initials of the first nationality
+	Nationality2 []string // country initials of the second nationality
+	Ethnic1      []Ethnic // ethnic mapped from the first nationality
+	Ethnic2      []Ethnic // ethnic mapped from the second nationality
+	AnyEthnic    []Ethnic // ethnic mapped from either nationality
+	Use          Ethnic   // resulting ethnic, FirstNationalityEthnic or SecondNationalityEthnic
+}
+
+// DefaultEthnicRules are evaluated in order, the first matching rule wins
+var DefaultEthnicRules = []EthnicRule{
+	{EthnicValues: []int{0}, AnyEthnic: []Ethnic{Scandinavian}, Use: Scandinavian},
+	{EthnicValues: []int{0}, AnyEthnic: []Ethnic{Caucasian}, Use: Caucasian},
+	{EthnicValues: []int{0}, Use: CentralEuropean},
+	{
+		EthnicValues: []int{1},
+		AnyEthnic: []Ethnic{
+			Scandinavian,
+			SouthEastAsian,
+			CentralEuropean,
+			Caucasian,
+			African,
+			Asian,
+			MiddleEastNorthAfrican,
+			MiddleEastSouthAsian,
+			EasternEuropeanCentralAsian,
+		},
+		Use: SouthAmerican,
+	},
+	{EthnicValues: []int{1}, Use: FirstNationalityEthnic},
+	{EthnicValues: []int{2}, AnyEthnic: []Ethnic{MiddleEastSouthAsian}, Use: MiddleEastSouthAsian},
+	{EthnicValues: []int{2}, Use: MiddleEastNorthAfrican},
+	{EthnicValues: []int{7}, Ethnic1: []Ethnic{SouthAmericanMediterranean}, Use: SouthAmericanMediterranean},
+	{EthnicValues: []int{7}, Ethnic1: []Ethnic{SouthAmerican}, Use: SouthAmerican},
+	{EthnicValues: []int{3, 6, 7, 8, 9}, Use: African},
+	{EthnicValues: []int{4}, Use: MiddleEastSouthAsian},
+	{EthnicValues: []int{5}, Use: SouthEastAsian},
+	{EthnicValues: []int{10}, Ethnic1: []Ethnic{SouthAmerican}, Use: SouthAmerican},
+	{EthnicValues: []int{10}, Use: Asian},
+}
+
+var EthnicRules = DefaultEthnicRules
+
+func matchesAny[T comparable](values []T, value T) bool {
+	return len(values) == 0 || slices.Contains(values, value)
+}
+
+func (rule EthnicRule) resolve(nationality1, nationality2 string, ethnic1, ethnic2 Ethnic, ethnicValue int) (Ethnic, bool) {
+	if !matchesAny(rule.EthnicValues, ethnicValue) ||
+		!matchesAny(rule.Nationality1, nationality1) ||
+		!matchesAny(rule.Nationality2, nationality2) ||
+		!matchesAny(rule.Ethnic1, ethnic1) ||
+		!matchesAny(rule.Ethnic2, ethnic2) {
+		return "", false
+	}
+
+	if len(rule.AnyEthnic) > 0 &&
+		!slices.Contains(rule.AnyEthnic, ethnic1) &&
+		!slices.Contains(rule.AnyEthnic, ethnic2) {
+		return "", false
+	}
+
+	switch rule.Use {
+	case FirstNationalityEthnic:
+		return ethnic1, ethnic1 != ""
+	case SecondNationalityEthnic:
+		return ethnic2, ethnic2 != ""
+	default:
+		return rule.Use, true
+	}
+}
+
+func validateEthnicRule(rule EthnicRule) error {
+	ruleErrors := []error{}
+
+	for _, ethnicValue := range rule.EthnicValues {
+		if ethnicValue < minEthnicValue || ethnicValue > maxEthnicValue {
+			ruleErrors = append(ruleErrors, fmt.Errorf("ethnic value %d is not between %d and %d", ethnicValue, minEthnicValue, maxEthnicValue))
+		}
+	}
+
+	for _, ethnics := range [][]Ethnic{rule.Ethnic1, rule.Ethnic2, rule.AnyEthnic} {
+		for _, ethnic := range ethnics {
+			if !IsValidEthnic(string(ethnic)) {
+				ruleErrors = append(ruleErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic`, ethnic))
+			}
+		}
+	}
+
+	switch {
+	case rule.Use == "":
+		ruleErrors = append(ruleErrors, errors.New("rule has no resulting ethnic"))
+	case rule.Use == FirstNationalityEthnic, rule.Use == SecondNationalityEthnic:
+	case !IsValidEthnic(string(rule.Use)):
+		ruleErrors = append(ruleErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic`, rule.Use))
+	}
+
+	return errors.Join(ruleErrors...)
+}
+
+// SetEthnicRules replaces the rules used to resolve ethnics, the rules are
+// left untouched if any of them is invalid
+func SetEthnicRules(rules []EthnicRule) error {
+	ruleErrors := []error{}
+
+	for i, rule := range rules {
+		if err := validateEthnicRule(rule); err != nil {
+			ruleErrors = append(ruleErrors, fmt.Errorf("ethnic rule %d: %w", i+1, err))
+		}
+	}
+
+	if len(rules) == 0 {
+		ruleErrors = append(ruleErrors, errors.New("no ethnic rules defined"))
+	}
+
+	if len(ruleErrors) > 0 {
+		return errors.Join(ruleErrors...)
+	}
+
+	EthnicRules = rules
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package mapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetEthnic_DefaultRules(t *testing.T) {
+	EthnicRules = DefaultEthnicRules
+
+	cases := []struct {
+		nationality1 string
+		nationality2 string
+		ethnicValue  int
+		expected     Ethnic
+	}{
+		{"FRA", "", 0, CentralEuropean},
+		{"FRA", "SWE", 0, Scandinavian},
+		{"ESP", "", 1, SpanishMediterranean},
+		{"ESP", "FRA", 1, SouthAmerican},
+		{"FRA", "IND", 2, MiddleEastSouthAsian},
+		{"ARG", "", 7, SouthAmericanMediterranean},
+		{"FRA", "", 7, African},
+		{"BRA", "", 10, SouthAmerican},
+		{"JPN", "", 10, Asian},
+	}
+
+	for _, c := range cases {
+		ethnic, err := getEthnic(c.nationality1, c.nationality2, c.ethnicValue)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if ethnic != c.expected {
+			t.Fatalf("expected %s/%s/%d to be %q, got %q", c.nationality1, c.nationality2, c.ethnicValue, c.expected, ethnic)
+		}
+	}
+}
+
+func TestSetEthnicRules_CustomRules(t *testing.T) {
+	defer func() { EthnicRules = DefaultEthnicRules }()
+
+	err := SetEthnicRules([]EthnicRule{
+		{EthnicValues: []int{1}, Nationality1: []string{"ESP"}, Use: SouthAmericanMediterranean},
+		{Use: SecondNationalityEthnic},
+		{Use: Caucasian},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if ethnic, _ := getEthnic("ESP", "", 1); ethnic != SouthAmericanMediterranean {
+		t.Fatalf("expected first rule to match, got %q", ethnic)
+	}
+	if ethnic, _ := getEthnic("ESP", "JPN", 4); ethnic != Asian {
+		t.Fatalf("expected second nationality rule to match, got %q", ethnic)
+	}
+	if ethnic, _ := getEthnic("ESP", "", 4); ethnic != Caucasian {
+		t.Fatalf("expected catch all rule to match, got %q", ethnic)
+	}
+}
+
+func TestSetEthnicRules_InvalidRules(t *testing.T) {
+	defer func() { EthnicRules = DefaultEthnicRules }()
+
+	err := SetEthnicRules([]EthnicRule{
+		{EthnicValues: []int{11}, Use: African},
+		{AnyEthnic: []Ethnic{"FakeEthnic"}},
+	})
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	for _, expected := range []string{
+		"ethnic rule 1: ethnic value 11 is not between 0 and 10",
+		`ethnic rule 2: ethnic value "FakeEthnic" is not valid ethnic`,
+		"rule has no resulting ethnic",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected error to contain %q, got %q", expected, err.Error())
+		}
+	}
+
+	if len(EthnicRules) != len(DefaultEthnicRules) {
+		t.Fatal("invalid rules should not have replaced the current rules")
+	}
+}
@@ -0,0 +1,91 @@
+package mapper
+
+import (
+	"errors"
+	"fmt"
+)
+
+type FallbackAction string
+
+const (
+	FallbackFail  FallbackAction = "fail"  // stop the run
+	FallbackReuse FallbackAction = "reuse" // reuse the least used image of the ethnic
+	FallbackSkip  FallbackAction = "skip"  // leave the player without an image
+
+	// key of the fallback policy used for ethnics without their own policy
+	DefaultFallbackKey = "default"
+)
+
+var ErrPlayerSkipped = errors.New("player skipped")
+
+// FallbackPolicy decides what happens when an ethnic runs out of images. The
+// related ethnics are tried in order before the action is taken.
+type FallbackPolicy struct {
+	Ethnics []Ethnic
+	Action  FallbackAction
+}
+
+func ValidateFallbackPolicy(policy FallbackPolicy) error {
+	policyErrors := []error{}
+
+	for _, ethnic := range policy.Ethnics {
+		if !IsValidEthnic(string(ethnic)) {
+			policyErrors = append(policyErrors, fmt.Errorf(`ethnic value "%s" is not valid ethnic`, ethnic))
+		}
+	}
+
+	switch policy.Action {
+	case "", FallbackFail, FallbackReuse, FallbackSkip:
+	default:
+		policyErrors = append(policyErrors, fmt.Errorf(`fallback policy "%s" is not one of %s, %s or %s`, policy.Action, FallbackFail, FallbackReuse, FallbackSkip))
+	}
+
+	return errors.Join(policyErrors...)
+}
+
+// ImageChoice is an image picked for a player, from another ethnic folder
+// than the player's when a fallback was used
+type ImageChoice struct {
+	Ethnic   Ethnic
+	Path     FilePath
+	Fallback string // describes the fallback that was used, empty if none
+}
+
+// GetImagePathWithFallback picks an image for the player and applies the
+// fallback policy when the player's ethnic runs out of images. It returns
+// ErrPlayerSkipped when the policy skips the player.
+func (images *ImagePool) GetImagePathWithFallback(player Person, removeFromPool bool, policy FallbackPolicy) (ImageChoice, error) {
+	filename, err := images.GetRandomImagePath(player, removeFromPool)
+	if err == nil {
+		return ImageChoice{Ethnic: player.Ethnic, Path: filename}, nil
+	}
+	if !errors.Is(err, ErrOutOfImages) {
+		return ImageChoice{}, err
+	}
+
+	for _, ethnic := range policy.Ethnics {
+		related := player
+		related.Ethnic = ethnic
+
+		filename, relatedErr := images.GetRandomImagePath(related, removeFromPool)
+		if relatedErr == nil {
+			return ImageChoice{Ethnic: ethnic, Path: filename, Fallback: fmt.Sprintf("related ethnic %s", ethnic)}, nil
+		}
+		if !errors.Is(relatedErr, ErrOutOfImages) {
+			return ImageChoice{}, relatedErr
+		}
+	}
+
+	switch policy.Action {
+	case FallbackReuse:
+		filename, reuseErr := images.GetLeastUsedImagePath(player)
+		if reuseErr != nil {
+			return ImageChoice{}, reuseErr
+		}
+		return ImageChoice{Ethnic: player.Ethnic, Path: filename, Fallback: "reused least used image"}, nil
+	case FallbackSkip:
+		return ImageChoice{}, fmt.Errorf("%w: %w", ErrPlayerSkipped, err)
+	default:
+		return ImageChoice{}, err
+	}
+}
@@ -0,0 +1,46 @@
+package mapper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetImagePathWithFallback_RelatedEthnic(t *testing.T) {
+	imagePool := newTestImagePool(t, "SpanMed/a.png")
+	policy := FallbackPolicy{Ethnics: []Ethnic{SouthAmerican, SpanishMediterranean}}
+
+	choice, err := imagePool.GetImagePathWithFallback(Person{ID: "1", Ethnic: SouthAmericanMediterranean}, true, policy)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if choice.Ethnic != SpanishMediterranean || choice.Path != "a" || choice.Fallback == "" {
+		t.Fatalf("expected an image from the related ethnic, got %+v", choice)
+	}
+}
+
+func TestGetImagePathWithFallback_ReuseLeastUsed(t *testing.T) {
+	imagePool := newTestImagePool(t, "Asian/a.png", "Asian/b.png")
+	imagePool.ExcludeImages([]FilePath{"Asian/a", "Asian/a", "Asian/b"})
+	policy := FallbackPolicy{Action: FallbackReuse}
+
+	choice, err := imagePool.GetImagePathWithFallback(Person{ID: "1", Ethnic: Asian}, true, policy)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if choice.Path != "b" {
+		t.Fatalf("expected the least used image, got %+v", choice)
+	}
+}
+
+func TestGetImagePathWithFallback_SkipAndFail(t *testing.T) {
+	imagePool := newTestImagePool(t)
+	player := Person{ID: "1", Ethnic: Asian}
+
+	if _, err := imagePool.GetImagePathWithFallback(player, true, FallbackPolicy{Action: FallbackSkip}); !errors.Is(err, ErrPlayerSkipped) {
+		t.Fatalf("expected the player to be skipped, got %v", err)
+	}
+
+	if _, err := imagePool.GetImagePathWithFallback(player, true, FallbackPolicy{}); !errors.Is(err, ErrOutOfImages) {
+		t.Fatalf("expected to run out of images, got %v", err)
+	}
+}
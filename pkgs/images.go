@@ -3,45 +3,289 @@ package mapper
 import (
 	"errors"
 	"fmt"
+	"hash/fnv"
+	"io/fs"
 	"math/rand"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	mapset "github.com/deckarep/golang-set/v2"
 )
 
+// skin tone buckets are subfolders of an ethnic folder named after the range
+// of skin tones they hold, ex: African/1-5 or African/20
+var skinToneBucketRegex = regexp.MustCompile(`^(\d+)(?:-(\d+))?$`)
+
+type skinToneRange struct {
+	min int
+	max int
+}
+
+func (r *skinToneRange) contains(skinTone int) bool {
+	return r != nil && r.min <= skinTone && skinTone <= r.max
+}
+
+func parseSkinToneBucket(folderName string) *skinToneRange {
+	matches := skinToneBucketRegex.FindStringSubmatch(folderName)
+	if matches == nil {
+		return nil
+	}
+
+	min, _ := strconv.Atoi(matches[1])
+	max := min
+	if matches[2] != "" {
+		max, _ = strconv.Atoi(matches[2])
+	}
+	if max < min {
+		min, max = max, min
+	}
+
+	return &skinToneRange{min, max}
+}
+
+// StaffFolder is the folder of an ethnic folder with the faces meant for
+// staff, ex: African/staff or African/staff/1-5. Players never get them and
+// staff get the other images of the ethnic once they run out.
+const StaffFolder = "staff"
+
+type poolImage struct {
+	path     FilePath       // relative to the ethnic folder, ex: 1-5/image
+	file     string         // relative to the ethnic folder with extension, ex: 1-5/image.png
+	root     int            // index of the image root the image comes from
+	skinTone *skinToneRange // nil when the image is not in a skin tone bucket
+	age      *ageBand       // nil when the image has no age band
+	staff    bool           // in the staff folder
+}
+
+var ErrOutOfImages = errors.New("ran out of images")
+
 type ImagePool struct {
-	pool map[Ethnic][]FilePath // ex: asian => [relative/path/to/image]
+	roots      []ImageRoot                 // highest priority first
+	origins    map[Ethnic]map[FilePath]int // root of each image
+	pool       map[Ethnic][]poolImage      // ex: asian => [relative/path/to/image]
+	images     map[Ethnic][]poolImage      // every image found, including excluded and assigned ones
+	usage      map[Ethnic]map[FilePath]int // times each image has been assigned
+	invalid    []InvalidImage              // files left out of the pool
+	missing    []Ethnic                    // ethnics without a folder
+	siblings   map[FilePath][]FilePath     // duplicates of an image, ex: African/a => [Asian/b]
+	rng        *rand.Rand
+	stableHash bool
+	balanced   bool
 }
 
-func NewImagePool(imageRootPath string) (*ImagePool, error) {
-	pool := make(map[Ethnic][]FilePath)
+func NewImagePool(imageRootPath string, options ImagePoolOptions) (*ImagePool, error) {
+	return NewLayeredImagePool([]ImageRoot{{Path: imageRootPath}}, options)
+}
 
-	for _, ethnic := range Ethnicities {
-		pool[ethnic] = make([]FilePath, 0)
+// NewLayeredImagePool merges the ethnic folders of several image roots. An
+// image found in more than one root, ex: African/image, is taken from the
+// root with the highest priority.
+func NewLayeredImagePool(roots []ImageRoot, options ImagePoolOptions) (*ImagePool, error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+	if len(roots) == 0 {
+		return nil, errors.New("at least one image directory is needed")
+	}
+	roots = SortImageRoots(roots)
 
-		files, err := os.ReadDir(path.Join(imageRootPath, string(ethnic)))
-		if err != nil {
-			return nil, errors.Join(fmt.Errorf("cannot get ethnic folder %s", ethnic), err)
-		}
+	pool := make(map[Ethnic][]poolImage)
+	invalidImages := make([]InvalidImage, 0)
+
+	missing := make([]Ethnic, 0)
+
+	for _, ethnic := range Ethnicities {
+		ethnicPool := make([]poolImage, 0)
+		found := false
+		seen := make(map[FilePath]bool)
 
-		for _, file := range files {
-			if file.IsDir() {
+		for rootIndex, root := range roots {
+			rootPool, rootInvalidImages, err := scanEthnicFolder(path.Join(root.Path, string(ethnic)), options)
+			if errors.Is(err, fs.ErrNotExist) {
+				// partial facepacks don't have every ethnic folder
 				continue
 			}
+			if err != nil {
+				return nil, errors.Join(fmt.Errorf("cannot get ethnic folder %s of %s", ethnic, root.Path), err)
+			}
+			found = true
+
+			for _, image := range rootPool {
+				if seen[image.path] {
+					continue // replaced by a root with a higher priority
+				}
+				seen[image.path] = true
+
+				image.root = rootIndex
+				ethnicPool = append(ethnicPool, image)
+			}
+
+			for _, invalidImage := range rootInvalidImages {
+				invalidImage.Ethnic = ethnic
+				invalidImage.Root = root.Path
+				invalidImages = append(invalidImages, invalidImage)
+			}
+		}
+
+		if !found {
+			missing = append(missing, ethnic)
+		}
+		pool[ethnic] = ethnicPool
+	}
+
+	images := make(map[Ethnic][]poolImage)
+	origins := make(map[Ethnic]map[FilePath]int)
+	usage := make(map[Ethnic]map[FilePath]int)
+	for ethnic, ethnicPool := range pool {
+		images[ethnic] = slices.Clone(ethnicPool)
+		usage[ethnic] = make(map[FilePath]int)
+		origins[ethnic] = make(map[FilePath]int)
+		for _, image := range ethnicPool {
+			origins[ethnic][image.path] = image.root
+		}
+	}
+
+	return &ImagePool{
+		roots:   roots,
+		pool:    pool,
+		images:  images,
+		origins: origins,
+		usage:   usage,
+		invalid: invalidImages,
+		missing: missing,
+		rng:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// InvalidImages are the files found in the ethnic folders that were left out
+// of the pool
+func (images *ImagePool) InvalidImages() []InvalidImage {
+	return images.invalid
+}
+
+// MissingEthnics are the ethnics that have no folder in any image root
+func (images *ImagePool) MissingEthnics() []Ethnic {
+	return images.missing
+}
+
+// HasEthnic tells whether the image root has a folder for the ethnic
+func (images *ImagePool) HasEthnic(ethnic Ethnic) bool {
+	_, ok := images.pool[ethnic]
+	return ok && !slices.Contains(images.missing, ethnic)
+}
+
+// Total is the number of images found for an ethnic
+func (images *ImagePool) Total(ethnic Ethnic) int {
+	return len(images.images[ethnic])
+}
+
+// Available is the number of images of an ethnic that can still be assigned
+func (images *ImagePool) Available(ethnic Ethnic) int {
+	return len(images.pool[ethnic])
+}
+
+// StaffTotal is the number of images found in the staff folder of an ethnic,
+// they are part of Total but never given to players
+func (images *ImagePool) StaffTotal(ethnic Ethnic) int {
+	return countStaffImages(images.images[ethnic])
+}
+
+// StaffAvailable is the number of images of the staff folder of an ethnic
+// that can still be assigned, they are part of Available
+func (images *ImagePool) StaffAvailable(ethnic Ethnic) int {
+	return countStaffImages(images.pool[ethnic])
+}
+
+func countStaffImages(poolImages []poolImage) int {
+	count := 0
+	for _, poolImage := range poolImages {
+		if poolImage.staff {
+			count++
+		}
+	}
+	return count
+}
+
+// Seed makes the random assignment reproducible, given the same images and
+// players in the same order
+func (images *ImagePool) Seed(seed int64) {
+	images.rng = rand.New(rand.NewSource(seed))
+}
+
+// UseStableHash derives the image of a player from their UID instead of
+// picking it at random, so a player gets the same image on every run with the
+// same images. When that image is taken the next best one is used.
+func (images *ImagePool) UseStableHash(stableHash bool) {
+	images.stableHash = stableHash
+}
+
+// UseBalanced makes every pick with duplicates allowed choose among the least
+// used images of the ethnic, so that images are spread evenly over players
+func (images *ImagePool) UseBalanced(balanced bool) {
+	images.balanced = balanced
+}
+
+func stableHashScore(id PlayerID, image FilePath) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(id))
+	hash.Write([]byte{0})
+	hash.Write([]byte(image))
+	return hash.Sum64()
+}
+
+// SplitEthnicImagePath splits an image path from the xml file into its ethnic
+// folder and the image path inside of that folder
+func SplitEthnicImagePath(filePath FilePath) (Ethnic, FilePath, bool) {
+	segments := strings.Split(string(filePath), "/")
+
+	for i, segment := range segments[:len(segments)-1] {
+		if IsValidEthnic(segment) {
+			return Ethnic(segment), FilePath(strings.Join(segments[i+1:], "/")), true
+		}
+	}
+
+	return "", "", false
+}
+
+// ImageExists checks for an image file in any format, as image paths in the
+// xml file have no extension
+func ImageExists(imagePath string) bool {
+	return NewImageFiles().Exists(imagePath)
+}
+
+// ImageFiles checks many image paths against the files on disk, every folder
+// is listed once
+type ImageFiles struct {
+	folders map[string]mapset.Set[string] // file names without extension by folder
+}
 
-			// football manager requires filenames but not filename.png
-			fullFilename := file.Name()
-			filename := strings.TrimSuffix(filepath.Base(fullFilename), filepath.Ext(fullFilename))
+func NewImageFiles() *ImageFiles {
+	return &ImageFiles{folders: make(map[string]mapset.Set[string])}
+}
 
-			pool[ethnic] = append(pool[ethnic], FilePath(filename))
+// Exists checks for an image file in any format, as image paths in the xml
+// file have no extension
+func (files *ImageFiles) Exists(imagePath string) bool {
+	folder := filepath.Dir(imagePath)
+	stems, ok := files.folders[folder]
+	if !ok {
+		stems = mapset.NewSet[string]()
+		entries, _ := os.ReadDir(folder)
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				stems.Add(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+			}
 		}
+		files.folders[folder] = stems
 	}
 
-	return &ImagePool{pool}, nil
+	return stems.Contains(filepath.Base(imagePath))
 }
 
 func (images *ImagePool) ExcludeImages(excludes []FilePath) error {
@@ -52,34 +296,36 @@ func (images *ImagePool) ExcludeImages(excludes []FilePath) error {
 		excludeSets[ethnic] = mapset.NewSet[FilePath]()
 	}
 
-	ethnictiesStrs := make([]string, len(Ethnicities))
-	for i, ethnic := range Ethnicities {
-		ethnictiesStrs[i] = string(ethnic)
-	}
-	ethnicRegexPattern := strings.Join(ethnictiesStrs, "|")
-	ethnicRegexPattern = strings.ReplaceAll(ethnicRegexPattern, " ", `\s`)
-	ethnicRegex := regexp.MustCompile(fmt.Sprintf(`\b(%s)\b`, ethnicRegexPattern))
-
-	imageFilenameRegex := regexp.MustCompile(`[^\/]+$`)
 	for _, filePath := range excludes {
-		ethnic := Ethnic(ethnicRegex.FindString(string(filePath)))
-		filename := FilePath(imageFilenameRegex.FindString(string(filePath)))
-		excludeSets[ethnic].Add(filename)
+		ethnic, imagePath, ok := SplitEthnicImagePath(filePath)
+		if !ok {
+			continue
+		}
+		excludeSets[ethnic].Add(imagePath)
+
+		// duplicates of an excluded image are excluded too
+		for _, sibling := range images.siblings[FilePath(path.Join(string(ethnic), string(imagePath)))] {
+			if siblingEthnic, siblingPath, ok := SplitEthnicImagePath(sibling); ok {
+				excludeSets[siblingEthnic].Add(siblingPath)
+			}
+		}
 	}
 
+	images.AddUsage(excludes)
+
 	for ethnic, ethnicPool := range images.pool {
 		excludeSet, hasSet := excludeSets[Ethnic(ethnic)]
 		if !hasSet {
 			continue
 		}
 
-		filteredPool := make([]FilePath, 0)
+		filteredPool := make([]poolImage, 0)
 
-		for _, filepath := range ethnicPool {
-			if excludeSet.Contains(filepath) {
+		for _, image := range ethnicPool {
+			if excludeSet.Contains(image.path) {
 				continue // ignore file
 			}
-			filteredPool = append(filteredPool, filepath)
+			filteredPool = append(filteredPool, image)
 		}
 
 		images.pool[ethnic] = filteredPool
@@ -88,25 +334,140 @@ func (images *ImagePool) ExcludeImages(excludes []FilePath) error {
 	return nil
 }
 
-func (images *ImagePool) GetRandomImagePath(ethnic Ethnic, removeFromPool bool) (FilePath, error) {
+// AddUsage counts images that are already assigned, ex: by the xml file
+func (images *ImagePool) AddUsage(assigned []FilePath) {
+	for _, filePath := range assigned {
+		ethnic, imagePath, ok := SplitEthnicImagePath(filePath)
+		if !ok {
+			continue
+		}
+		if _, ok := images.usage[ethnic]; ok {
+			images.usage[ethnic][imagePath]++
+		}
+	}
+}
+
+func (images *ImagePool) outOfImages(ethnic Ethnic) error {
+	if slices.Contains(images.missing, ethnic) {
+		return fmt.Errorf("%w for ethnicity: %s, it has no image folder", ErrOutOfImages, ethnic)
+	}
+	return fmt.Errorf("%w for ethnicity: %s", ErrOutOfImages, ethnic)
+}
+
+// candidates returns the indexes of the images in the person's skin tone
+// bucket and age band. It falls back to the skin tone bucket alone, then to
+// the age band alone and then to every image. Staff only look at the staff
+// images while there are any left.
+func candidates(ethnicImages []poolImage, person Person) []int {
+	staff := person.Role == RoleStaff && slices.ContainsFunc(ethnicImages, func(image poolImage) bool {
+		return image.staff
+	})
+
+	skinTone := func(image poolImage) bool {
+		return person.SkinTone > 0 && image.skinTone.contains(person.SkinTone)
+	}
+	age := func(image poolImage) bool {
+		return person.Age > 0 && image.age.contains(person.Age)
+	}
+	matches := []func(poolImage) bool{
+		func(image poolImage) bool { return skinTone(image) && age(image) },
+		skinTone,
+		age,
+		func(poolImage) bool { return true },
+	}
+
+	indexes := make([]int, 0)
+	for _, match := range matches {
+		for index, image := range ethnicImages {
+			if image.staff == staff && match(image) {
+				indexes = append(indexes, index)
+			}
+		}
+		if len(indexes) > 0 {
+			break
+		}
+	}
+
+	return indexes
+}
+
+// pick chooses one of the candidates for a player, candidates can't be empty
+func (images *ImagePool) pick(player Person, ethnicImages []poolImage, candidates []int) int {
+	if !images.stableHash {
+		return candidates[images.rng.Intn(len(candidates))]
+	}
+
+	// rendezvous hashing, the best image for a player stays the same no
+	// matter which other images are in the pool
 	var index int
+	var bestScore uint64
+	for i, candidate := range candidates {
+		score := stableHashScore(player.ID, ethnicImages[candidate].path)
+		if i == 0 || score > bestScore {
+			index, bestScore = candidate, score
+		}
+	}
+	return index
+}
+
+func (images *ImagePool) GetRandomImagePath(player Person, removeFromPool bool) (FilePath, error) {
+	if images.balanced && !removeFromPool {
+		return images.GetLeastUsedImagePath(player)
+	}
+
+	ethnicPool := images.pool[player.Ethnic]
 
-	length := len(images.pool[ethnic])
-	if length == 0 {
-		return "", fmt.Errorf("ran out of images for ethnicity: %s", ethnic)
-	} else if length == 1 {
-		index = 0
-	} else {
-		index = rand.Intn(length - 1)
+	candidates := candidates(ethnicPool, player)
+	if len(candidates) == 0 {
+		return "", images.outOfImages(player.Ethnic)
 	}
 
-	filename := images.pool[ethnic][index]
+	index := images.pick(player, ethnicPool, candidates)
+	filename := ethnicPool[index].path
+	images.usage[player.Ethnic][filename]++
 
 	if removeFromPool {
 		// remove file from ethnic pool
-		images.pool[ethnic][index] = images.pool[ethnic][length-1]
-		images.pool[ethnic] = images.pool[ethnic][:length-1]
+		last := len(ethnicPool) - 1
+		ethnicPool[index] = ethnicPool[last]
+		images.pool[player.Ethnic] = ethnicPool[:last]
+		images.removeSiblings(player.Ethnic, filename)
+	}
+
+	return filename, nil
+}
+
+// GetLeastUsedImagePath picks among the images of the player's ethnic that
+// have been assigned the least, including images that are not in the pool
+func (images *ImagePool) GetLeastUsedImagePath(player Person) (FilePath, error) {
+	ethnicImages := images.images[player.Ethnic]
+	usage := images.usage[player.Ethnic]
+
+	leastUsed := make([]int, 0)
+	for _, candidate := range candidates(ethnicImages, player) {
+		count := usage[ethnicImages[candidate].path]
+		if len(leastUsed) > 0 {
+			leastCount := usage[ethnicImages[leastUsed[0]].path]
+			if count > leastCount {
+				continue
+			}
+			if count < leastCount {
+				leastUsed = leastUsed[:0]
+			}
+		}
+		leastUsed = append(leastUsed, candidate)
 	}
 
+	if len(leastUsed) == 0 {
+		return "", images.outOfImages(player.Ethnic)
+	}
+
+	filename := ethnicImages[images.pick(player, ethnicImages, leastUsed)].path
+	usage[filename]++
+
+	images.pool[player.Ethnic] = slices.DeleteFunc(images.pool[player.Ethnic], func(image poolImage) bool {
+		return image.path == filename
+	})
+
 	return filename, nil
 }
@@ -0,0 +1,233 @@
+package mapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeImages(t *testing.T, root string, relativePaths ...string) {
+	t.Helper()
+
+	for _, relativePath := range relativePaths {
+		imagePath := filepath.Join(root, relativePath)
+		if err := os.MkdirAll(filepath.Dir(imagePath), 0o755); err != nil {
+			t.Fatalf("could not create image folder: %v", err)
+		}
+		if err := os.WriteFile(imagePath, []byte{}, 0o644); err != nil {
+			t.Fatalf("could not write image: %v", err)
+		}
+	}
+}
+
+func newTestImagePool(t *testing.T, relativePaths ...string) *ImagePool {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, ethnic := range Ethnicities {
+		if err := os.MkdirAll(filepath.Join(root, string(ethnic)), 0o755); err != nil {
+			t.Fatalf("could not create ethnic folder: %v", err)
+		}
+	}
+	writeImages(t, root, relativePaths...)
+
+	imagePool, err := NewImagePool(root, ImagePoolOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	return imagePool
+}
+
+func TestGetRandomImagePath_SkinToneBucket(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/1-5/light.png", "African/6-10/dark.png")
+
+	filename, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, SkinTone: 8}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "6-10/dark" {
+		t.Fatalf("expected image from the 6-10 bucket, got %q", filename)
+	}
+}
+
+func TestGetRandomImagePath_EmptyBucketFallsBackToEthnicFolder(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/1-5/light.png", "African/6-10/dark.png")
+
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, SkinTone: 7}, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	filename, err := imagePool.GetRandomImagePath(Person{ID: "2", Ethnic: African, SkinTone: 9}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "1-5/light" {
+		t.Fatalf("expected fallback to the rest of the ethnic folder, got %q", filename)
+	}
+}
+
+func TestExcludeImages_SkinToneBucket(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/1-5/light.png", "African/1-5/other.png")
+
+	if err := imagePool.ExcludeImages([]FilePath{"faces/African/1-5/light"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	filename, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, SkinTone: 2}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "1-5/other" {
+		t.Fatalf("expected excluded image to be skipped, got %q", filename)
+	}
+}
+
+func TestGetRandomImagePath_SeedIsReproducible(t *testing.T) {
+	pick := func() []FilePath {
+		imagePool := newTestImagePool(t, "Asian/a.png", "Asian/b.png", "Asian/c.png", "Asian/d.png")
+		imagePool.Seed(42)
+
+		filenames := make([]FilePath, 0)
+		for _, id := range []PlayerID{"1", "2", "3"} {
+			filename, err := imagePool.GetRandomImagePath(Person{ID: id, Ethnic: Asian}, true)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			filenames = append(filenames, filename)
+		}
+		return filenames
+	}
+
+	first, second := pick(), pick()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("expected the same images for the same seed, got %v and %v", first, second)
+		}
+	}
+}
+
+func TestGetRandomImagePath_StableHash(t *testing.T) {
+	player := Person{ID: "2000133376", Ethnic: Asian}
+
+	imagePool := newTestImagePool(t, "Asian/a.png", "Asian/b.png", "Asian/c.png", "Asian/d.png")
+	imagePool.UseStableHash(true)
+	expected, _ := imagePool.GetRandomImagePath(player, true)
+
+	// other players taking other images must not change the image of this one
+	imagePool = newTestImagePool(t, "Asian/a.png", "Asian/b.png", "Asian/c.png", "Asian/d.png")
+	imagePool.UseStableHash(true)
+	for _, image := range []FilePath{"a", "b", "c", "d"} {
+		if image != expected {
+			if err := imagePool.ExcludeImages([]FilePath{"Asian/" + image}); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			break
+		}
+	}
+
+	if filename, _ := imagePool.GetRandomImagePath(player, true); filename != expected {
+		t.Fatalf("expected the same image %q for the same player, got %q", expected, filename)
+	}
+}
+
+func TestGetRandomImagePath_Balanced(t *testing.T) {
+	imagePool := newTestImagePool(t, "Asian/a.png", "Asian/b.png", "Asian/c.png")
+	imagePool.UseBalanced(true)
+	imagePool.AddUsage([]FilePath{"Asian/a", "Asian/b"})
+
+	usage := map[FilePath]int{"a": 1, "b": 1}
+	for _, id := range []PlayerID{"1", "2", "3", "4"} {
+		filename, err := imagePool.GetRandomImagePath(Person{ID: id, Ethnic: Asian}, false)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		usage[filename]++
+	}
+
+	for _, image := range []FilePath{"a", "b", "c"} {
+		if usage[image] != 2 {
+			t.Fatalf("expected every image to be used twice, got %v", usage)
+		}
+	}
+}
+
+func TestNewImagePool_MissingEthnicFolder(t *testing.T) {
+	root := t.TempDir()
+	writeImages(t, root, "African/a.png")
+
+	imagePool, err := NewImagePool(root, ImagePoolOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(imagePool.MissingEthnics()) != len(Ethnicities)-1 || !imagePool.HasEthnic(African) || imagePool.HasEthnic(Asian) {
+		t.Fatalf("expected every ethnic but African to be missing, got %v", imagePool.MissingEthnics())
+	}
+
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African}, true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "2", Ethnic: Asian}, true); !errors.Is(err, ErrOutOfImages) {
+		t.Fatalf("expected ErrOutOfImages, got %v", err)
+	}
+}
+
+func TestGetRandomImagePath_StaffFolder(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/young.png", "African/staff/old.png")
+
+	filename, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, Role: RoleStaff}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "staff/old" {
+		t.Fatalf("expected the staff image for staff, got %q", filename)
+	}
+
+	// once the staff images run out, staff get the other images
+	filename, err = imagePool.GetRandomImagePath(Person{ID: "2", Ethnic: African, Role: RoleStaff}, true)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if filename != "young" {
+		t.Fatalf("expected the other image once staff images ran out, got %q", filename)
+	}
+}
+
+func TestGetRandomImagePath_PlayersSkipStaffFolder(t *testing.T) {
+	imagePool := newTestImagePool(t, "African/staff/old.png")
+
+	if _, err := imagePool.GetRandomImagePath(Person{ID: "1", Ethnic: African, Role: RolePlayer}, true); !errors.Is(err, ErrOutOfImages) {
+		t.Fatalf("expected ErrOutOfImages for a player, got %v", err)
+	}
+}
+
+func TestImageFiles_Exists(t *testing.T) {
+	root := t.TempDir()
+	writeImages(t, root, "African/a.png", "African/b.jpg", "African/c/d.png")
+
+	imageFiles := NewImageFiles()
+	cases := map[string]bool{
+		"African/a":   true,
+		"African/b":   true,
+		"African/c":   false,
+		"African/c/d": true,
+		"African/e":   false,
+		"Asian/a":     false,
+	}
+	for imagePath, expected := range cases {
+		if imageFiles.Exists(filepath.Join(root, filepath.FromSlash(imagePath))) != expected {
+			t.Fatalf("expected %s to exist: %t", imagePath, expected)
+		}
+	}
+
+	// the listing of a folder is read once
+	writeImages(t, root, "African/e.png")
+	if imageFiles.Exists(filepath.Join(root, "African", "e")) {
+		t.Fatal("expected the listing of African to be cached")
+	}
+	if !ImageExists(filepath.Join(root, "African", "e")) {
+		t.Fatal("expected a new image to be found without the cache")
+	}
+}
@@ -1,64 +1,60 @@
 package mapper
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"regexp"
-	"strings"
+	"sort"
+
+	internal "jaqen/internal"
 )
 
 type Record struct {
 	From string `xml:"from,attr"`
 	To   string `xml:"to,attr"`
 }
-type XMLStruct struct {
-	XMLName xml.Name `xml:"record"`
-	Boolean []struct {
-		ID    string `xml:"id,attr"`
-		Value string `xml:"value,attr"`
-	} `xml:"boolean"`
-	List struct {
-		ID     string   `xml:"id,attr"`
-		Record []Record `xml:"record"`
-	} `xml:"list"`
-}
 
-type Mapping struct {
-	instance   *XMLStruct
-	idImageMap map[PlayerID]FilePath
-	fmVersion  string
+// span is a byte range of the xml document, end excluded
+type span struct {
+	start int
+	end   int
 }
 
-func convertToPathToPlayerID(toPath string, fmVersion string) PlayerID {
-	var idRegex *regexp.Regexp
-	switch fmVersion {
-	case "2024":
-		idRegex = regexp.MustCompile(`r-\d+`)
-	default:
-		idRegex = regexp.MustCompile(`\d+`)
-	}
-
-	playerID := PlayerID(idRegex.Find([]byte(toPath)))
-
-	switch fmVersion {
-	case "2024":
-		playerID = PlayerID(strings.TrimPrefix(string(playerID), "r-"))
-	default:
-	}
+// xmlLayout locates the parts of config.xml that jaqen manages, everything
+// else is written back byte for byte
+type xmlLayout struct {
+	rootEnd      int               // start of the </record> closing the document
+	booleans     map[string]string // value of every boolean by id
+	newline      string            // line ending of the document, \n or \r\n
+	listFound    bool
+	listEnd      int        // start of the whitespace before </list>
+	faceRecords  []span     // face records of the maps list, with their indentation
+	faceMappings []recordAt // from and to of every face record, in document order
+	unmanaged    []Record   // every other record of the maps list
+}
 
-	return playerID
+type recordAt struct {
+	Record
+	span span
 }
 
-func convertPlayerIDToToPath(id PlayerID) string {
-	return fmt.Sprintf("graphics/pictures/person/%s/portrait", string(id))
+type Mapping struct {
+	document   []byte
+	layout     *xmlLayout
+	idImageMap map[PlayerID]FilePath
+	fmVersion  *FMVersion
 }
 
-func NewMapping(xmlPath string, fmVersion string) (*Mapping, error) {
+func NewMapping(xmlPath string, version string) (*Mapping, error) {
+	fmVersion, err := LookupFMVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
 	parser := &Mapping{
-		instance:   nil,
 		idImageMap: make(map[PlayerID]FilePath),
 		fmVersion:  fmVersion,
 	}
@@ -74,19 +70,148 @@ func NewMapping(xmlPath string, fmVersion string) (*Mapping, error) {
 	}
 	defer xmlFile.Close()
 
-	if err := xml.Unmarshal(xmlBytes, &parser.instance); err != nil {
+	if err := parser.load(xmlBytes); err != nil {
 		return nil, errors.Join(errors.New("cannot unmarshall xml file"), err)
 	}
 
-	for _, record := range parser.instance.List.Record {
-		playerID := convertToPathToPlayerID(record.To, parser.fmVersion)
-		filepath := FilePath(record.From)
-		parser.idImageMap[playerID] = filepath
+	for _, record := range parser.layout.faceMappings {
+		playerID, _ := parser.fmVersion.PlayerID(record.To)
+		parser.idImageMap[playerID] = FilePath(record.From)
 	}
 
 	return parser, nil
 }
 
+func attr(element xml.StartElement, name string) string {
+	for _, attribute := range element.Attr {
+		if attribute.Name.Local == name {
+			return attribute.Value
+		}
+	}
+	return ""
+}
+
+// lineStart moves back over the indentation in front of offset, up to and
+// including the line break, so that removing an element leaves no blank line
+func lineStart(document []byte, offset int) int {
+	start := offset
+	for start > 0 && (document[start-1] == ' ' || document[start-1] == '\t') {
+		start--
+	}
+	if start > 0 && document[start-1] == '\n' {
+		start--
+		if start > 0 && document[start-1] == '\r' {
+			start--
+		}
+	}
+	return start
+}
+
+// expandSelfClosing turns the self-closing element between start and end into
+// an open and a close tag, so that records can be inserted into it
+func expandSelfClosing(document []byte, start int, end int, name string) []byte {
+	var indent []byte
+	if lineStart := lineStart(document, start); lineStart < start {
+		indent = bytes.TrimLeft(document[lineStart:start], "\r\n")
+	}
+
+	expanded := make([]byte, 0, len(document)+len(name)+len(indent)+4)
+	expanded = append(expanded, bytes.TrimRight(document[:end-len("/>")], " \t\r\n")...)
+	expanded = append(expanded, ">"+lineEnding(document)...)
+	expanded = append(expanded, indent...)
+	expanded = append(expanded, "</"+name+">"...)
+	return append(expanded, document[end:]...)
+}
+
+// load reads the layout of the xml document
+func (m *Mapping) load(document []byte) error {
+	layout := &xmlLayout{booleans: make(map[string]string), newline: lineEnding(document)}
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	depth := 0
+	inMaps := false
+	rootFound := false
+
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			end := int(decoder.InputOffset())
+			selfClosing := bytes.HasSuffix(document[:end], []byte("/>"))
+			switch {
+			case depth == 1:
+				if element.Name.Local != "record" {
+					return fmt.Errorf("expected element type <record> but have <%s>", element.Name.Local)
+				}
+				if selfClosing {
+					return m.load(expandSelfClosing(document, offset, end, element.Name.Local))
+				}
+				rootFound = true
+			case depth == 2 && element.Name.Local == "boolean":
+				layout.booleans[attr(element, "id")] = attr(element, "value")
+			case depth == 2 && element.Name.Local == "list" && attr(element, "id") == "maps" && !layout.listFound:
+				if selfClosing {
+					return m.load(expandSelfClosing(document, offset, end, element.Name.Local))
+				}
+				layout.listFound = true
+				inMaps = true
+			case depth == 3 && inMaps && element.Name.Local == "record":
+				record := Record{From: attr(element, "from"), To: attr(element, "to")}
+				if m.fmVersion.ClassifyRecord(record) == RecordFace {
+					layout.faceMappings = append(layout.faceMappings, recordAt{record, span{start: offset}})
+				} else {
+					layout.unmanaged = append(layout.unmanaged, record)
+				}
+			}
+		case xml.EndElement:
+			end := int(decoder.InputOffset())
+			switch {
+			case depth == 1:
+				layout.rootEnd = offset
+			case depth == 2 && inMaps:
+				layout.listEnd = lineStart(document, offset)
+				inMaps = false
+			case depth == 3 && inMaps && len(layout.faceMappings) > 0:
+				last := &layout.faceMappings[len(layout.faceMappings)-1]
+				if last.span.end == 0 && element.Name.Local == "record" {
+					last.span.end = end
+					layout.faceRecords = append(layout.faceRecords, span{lineStart(document, last.span.start), end})
+				}
+			}
+			depth--
+		}
+	}
+
+	if !rootFound {
+		return errors.New("root <record> element not found")
+	}
+
+	m.document = document
+	m.layout = layout
+	return nil
+}
+
+// Boolean returns the value of a boolean of the document, ex: preload
+func (m *Mapping) Boolean(id string) (string, bool) {
+	value, ok := m.layout.booleans[id]
+	return value, ok
+}
+
+// UnmanagedRecords returns the records of the maps list that are not faces,
+// they are written back untouched
+func (m *Mapping) UnmanagedRecords() []Record {
+	return m.layout.unmanaged
+}
+
 func (m *Mapping) AssignedImages() []FilePath {
 	return MapValues(m.idImageMap)
 }
@@ -96,46 +221,109 @@ func (m *Mapping) Exist(id PlayerID) bool {
 	return ok
 }
 
-func (m *Mapping) MapToImage(id PlayerID, filepath FilePath) {
-	m.idImageMap[id] = filepath
+func (m *Mapping) Image(id PlayerID) (FilePath, bool) {
+	filepath, ok := m.idImageMap[id]
+	return filepath, ok
 }
 
-func (m *Mapping) Save() error {
-	if m.instance == nil {
-		return errors.New("unintialised instance")
+// Images returns a copy of every player id and their image path
+func (m *Mapping) Images() map[PlayerID]FilePath {
+	images := make(map[PlayerID]FilePath, len(m.idImageMap))
+	for id, filepath := range m.idImageMap {
+		images[id] = filepath
 	}
+	return images
+}
 
-	m.instance.List.Record = make([]Record, 0)
+func (m *Mapping) Remove(id PlayerID) {
+	delete(m.idImageMap, id)
+}
 
-	for id, filename := range m.idImageMap {
-		var playerID PlayerID
-		switch m.fmVersion {
-		case "2024":
-			playerID = PlayerID(fmt.Sprintf("r-%s", id))
-		default:
-			playerID = id
+func (m *Mapping) MapToImage(id PlayerID, filepath FilePath) {
+	m.idImageMap[id] = filepath
+}
+
+// sortedIDs orders player ids by their number, so that the file diffs cleanly
+func (m *Mapping) sortedIDs() []PlayerID {
+	ids := make([]PlayerID, 0, len(m.idImageMap))
+	for id := range m.idImageMap {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if len(ids[i]) != len(ids[j]) {
+			return len(ids[i]) < len(ids[j])
 		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
 
-		m.instance.List.Record = append(m.instance.List.Record, Record{From: string(filename), To: convertPlayerIDToToPath(playerID)})
+func writeElement(buffer *bytes.Buffer, newline string, indent string, name string, attributes ...string) {
+	buffer.WriteString(newline + indent + "<" + name)
+	for i := 0; i+1 < len(attributes); i += 2 {
+		buffer.WriteString(" " + attributes[i] + `="`)
+		xml.EscapeText(buffer, []byte(attributes[i+1]))
+		buffer.WriteString(`"`)
 	}
+	buffer.WriteString("/>")
+}
 
-	return nil
+// lineEnding is \r\n for a document written on windows, \n otherwise
+func lineEnding(document []byte) string {
+	if bytes.Contains(document, []byte("\r\n")) {
+		return "\r\n"
+	}
+	return "\n"
 }
 
-func (m *Mapping) Write(xmlPath string) error {
-	rtnXML, err := xml.MarshalIndent(m.instance, "", "\t")
-	if err != nil {
-		return err
+// Save replaces the face records of the document with the current mapping,
+// and adds the maps list when there is none. Everything else in the document
+// is kept as it is.
+func (m *Mapping) Save() error {
+	if m.layout == nil {
+		return errors.New("unintialised instance")
 	}
 
-	xmlFile, err := os.Create(xmlPath)
-	if err != nil {
-		return err
+	newline := m.layout.newline
+	var records bytes.Buffer
+	if !m.layout.listFound {
+		records.WriteString(newline + "\t<list id=\"maps\">")
+	}
+	for _, id := range m.sortedIDs() {
+		writeElement(&records, newline, "\t\t", "record", "from", string(m.idImageMap[id]), "to", m.fmVersion.ToPath(id))
+	}
+	insertAt := m.layout.listEnd
+	if !m.layout.listFound {
+		records.WriteString(newline + "\t</list>")
+		insertAt = lineStart(m.document, m.layout.rootEnd)
 	}
 
-	if _, err := xmlFile.Write(rtnXML); err != nil {
-		return err
+	var document bytes.Buffer
+	position := 0
+	inserted := false
+	for _, removal := range m.layout.faceRecords {
+		if !inserted && removal.start >= insertAt {
+			document.Write(m.document[position:insertAt])
+			document.Write(records.Bytes())
+			position, inserted = insertAt, true
+		}
+		document.Write(m.document[position:removal.start])
+		position = removal.end
+	}
+	if !inserted {
+		document.Write(m.document[position:insertAt])
+		document.Write(records.Bytes())
+		position = insertAt
 	}
+	document.Write(m.document[position:])
 
-	return nil
+	return m.load(document.Bytes())
+}
+
+func (m *Mapping) Write(xmlPath string) error {
+	if m.layout == nil {
+		return errors.New("unintialised instance")
+	}
+
+	return internal.WriteFileAtomic(xmlPath, m.document)
 }
@@ -0,0 +1,251 @@
+package mapper
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func saveMapping(t *testing.T, mapping *Mapping, xmlPath string) string {
+	t.Helper()
+
+	if err := mapping.Save(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := mapping.Write(xmlPath); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	content, err := os.ReadFile(xmlPath)
+	if err != nil {
+		t.Fatalf("could not read xml file: %v", err)
+	}
+	return string(content)
+}
+
+const customConfigXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- edited by hand -->
+<record>
+	<boolean id="preload" value="true"/>
+	<boolean id="amap" value="false"/>
+	<integer id="custom" value="3"/>
+	<list id="maps">
+		<record from="keep/badge" to="graphics/pictures/club/1/logo"/>
+		<!-- my favourite regens -->
+		<record from="African/b" to="graphics/pictures/person/r-20/portrait"/>
+		<record from="African/a" to="graphics/pictures/person/r-3/portrait"/>
+	</list>
+	<list id="extra">
+		<record from="x" to="graphics/pictures/person/r-99/portrait"/>
+	</list>
+</record>
+`
+
+func TestMapping_SaveWithoutChangesSortsFaceRecords(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", customConfigXML)
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- edited by hand -->
+<record>
+	<boolean id="preload" value="true"/>
+	<boolean id="amap" value="false"/>
+	<integer id="custom" value="3"/>
+	<list id="maps">
+		<record from="keep/badge" to="graphics/pictures/club/1/logo"/>
+		<!-- my favourite regens -->
+		<record from="African/a" to="graphics/pictures/person/r-3/portrait"/>
+		<record from="African/b" to="graphics/pictures/person/r-20/portrait"/>
+	</list>
+	<list id="extra">
+		<record from="x" to="graphics/pictures/person/r-99/portrait"/>
+	</list>
+</record>
+`
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+
+	// saving a second time gives the same file
+	mapping, err = NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected a stable file, got:\n%s", content)
+	}
+}
+
+func TestMapping_SaveReplacesFaceRecords(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", customConfigXML)
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if mapping.Exist("99") {
+		t.Fatal("expected records outside of the maps list to be ignored")
+	}
+
+	mapping.Remove("20")
+	mapping.MapToImage("100", "Asian/c&d")
+
+	content := saveMapping(t, mapping, xmlPath)
+
+	for _, expected := range []string{
+		"<!-- edited by hand -->",
+		`<integer id="custom" value="3"/>`,
+		`<record from="keep/badge" to="graphics/pictures/club/1/logo"/>`,
+		"<!-- my favourite regens -->",
+		`<record from="x" to="graphics/pictures/person/r-99/portrait"/>`,
+		"\t\t<record from=\"African/a\" to=\"graphics/pictures/person/r-3/portrait\"/>\n" +
+			"\t\t<record from=\"Asian/c&amp;d\" to=\"graphics/pictures/person/r-100/portrait\"/>\n\t</list>",
+	} {
+		if !strings.Contains(content, expected) {
+			t.Fatalf("expected %q to be kept, got:\n%s", expected, content)
+		}
+	}
+	if strings.Contains(content, "r-20/") {
+		t.Fatalf("expected the removed record to be gone, got:\n%s", content)
+	}
+}
+
+func TestMapping_SaveAddsMissingList(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", "<record>\n\t<integer id=\"custom\" value=\"3\"/>\n</record>\n")
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping.MapToImage("1", "African/a")
+
+	// booleans the user did not set are left out
+	expected := "<record>\n" +
+		"\t<integer id=\"custom\" value=\"3\"/>\n" +
+		"\t<list id=\"maps\">\n" +
+		"\t\t<record from=\"African/a\" to=\"graphics/pictures/person/r-1/portrait\"/>\n" +
+		"\t</list>\n" +
+		"</record>\n"
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestMapping_SaveIntoSelfClosingList(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", "<record>\n\t<boolean id=\"preload\" value=\"false\"/>\n\t<boolean id=\"amap\" value=\"false\"/>\n\t<list id=\"maps\"/>\n\t<integer id=\"custom\" value=\"3\"/>\n</record>\n")
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping.MapToImage("1", "African/a")
+
+	expected := "<record>\n" +
+		"\t<boolean id=\"preload\" value=\"false\"/>\n" +
+		"\t<boolean id=\"amap\" value=\"false\"/>\n" +
+		"\t<list id=\"maps\">\n" +
+		"\t\t<record from=\"African/a\" to=\"graphics/pictures/person/r-1/portrait\"/>\n" +
+		"\t</list>\n" +
+		"\t<integer id=\"custom\" value=\"3\"/>\n" +
+		"</record>\n"
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestMapping_SaveIntoSelfClosingRoot(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", "<record/>\n")
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping.MapToImage("1", "African/a")
+
+	expected := "<record>\n" +
+		"\t<list id=\"maps\">\n" +
+		"\t\t<record from=\"African/a\" to=\"graphics/pictures/person/r-1/portrait\"/>\n" +
+		"\t</list>\n" +
+		"</record>\n"
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
+
+func TestMapping_SaveKeepsWindowsLineEndings(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", "<record>\r\n\t<list id=\"maps\"/>\r\n</record>\r\n")
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	mapping.MapToImage("1", "African/a")
+	mapping.MapToImage("2", "African/b")
+
+	expected := "<record>\r\n" +
+		"\t<list id=\"maps\">\r\n" +
+		"\t\t<record from=\"African/a\" to=\"graphics/pictures/person/r-1/portrait\"/>\r\n" +
+		"\t\t<record from=\"African/b\" to=\"graphics/pictures/person/r-2/portrait\"/>\r\n" +
+		"\t</list>\r\n" +
+		"</record>\r\n"
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%q\ngot:\n%q", expected, content)
+	}
+}
+
+func TestNewMapping_WrongRoot(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", "<config></config>")
+
+	if _, err := NewMapping(xmlPath, "2024"); err == nil {
+		t.Fatal("expected an error for a root that is not a record")
+	}
+}
+
+func TestMapping_OtherRecordsPassThrough(t *testing.T) {
+	xmlPath := writeTempFile(t, "config.xml", `<record>
+	<boolean id="preload" value="false"/>
+	<boolean id="amap" value="false"/>
+	<list id="maps">
+		<record from="logos/12" to="graphics/pictures/club/12/logo"/>
+		<record from="African/a" to="graphics/pictures/person/r-5/portrait"/>
+		<record from="kits/5" to="graphics/pictures/person/r-5/kit"/>
+		<record from="old/face" to="graphics/pictures/person/7/portrait"/>
+		<record from="staff" to="graphics/pictures/person/r-8/portrait"><note>coach</note></record>
+	</list>
+</record>
+`)
+
+	mapping, err := NewMapping(xmlPath, "2024")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(mapping.UnmanagedRecords()) != 3 {
+		t.Fatalf("expected 3 unmanaged records, got %v", mapping.UnmanagedRecords())
+	}
+	if !mapping.Exist("5") || !mapping.Exist("8") || mapping.Exist("7") {
+		t.Fatalf("expected only the 2024 portraits to be managed, got %v", mapping.Images())
+	}
+
+	mapping.Remove("8")
+	mapping.MapToImage("5", "Asian/b")
+
+	expected := `<record>
+	<boolean id="preload" value="false"/>
+	<boolean id="amap" value="false"/>
+	<list id="maps">
+		<record from="logos/12" to="graphics/pictures/club/12/logo"/>
+		<record from="kits/5" to="graphics/pictures/person/r-5/kit"/>
+		<record from="old/face" to="graphics/pictures/person/7/portrait"/>
+		<record from="Asian/b" to="graphics/pictures/person/r-5/portrait"/>
+	</list>
+</record>
+`
+	if content := saveMapping(t, mapping, xmlPath); content != expected {
+		t.Fatalf("expected:\n%s\ngot:\n%s", expected, content)
+	}
+}
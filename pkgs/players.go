@@ -5,137 +5,268 @@ import (
 	"errors"
 	"fmt"
 	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var ErrBadRTFFormat string = "bad RTF Format:\n%w"
 
+var ErrUnknownNationality = errors.New("ethnic not found for country initials")
+
+type UnknownNationalityPolicy string
+
+const (
+	UnknownNationalityFail    UnknownNationalityPolicy = "fail"    // stop with an error
+	UnknownNationalitySkip    UnknownNationalityPolicy = "skip"    // leave the player out
+	UnknownNationalityDefault UnknownNationalityPolicy = "default" // use the default ethnic for the nationality
+)
+
+// maximum number of example UIDs kept for each unknown nationality
+const unknownNationalityExamples = 3
+
+type ReadOptions struct {
+	UnknownNationality UnknownNationalityPolicy // fail when empty
+	DefaultEthnic      Ethnic                   // ethnic of unknown nationalities with the default policy
+	Role               Role                     // role of the rows without a job column, player when empty
+	Date               time.Time                // ages are counted at this date from a bare date of birth, today when zero
+}
+
+func ValidateReadOptions(options ReadOptions) error {
+	switch options.UnknownNationality {
+	case "", UnknownNationalityFail, UnknownNationalitySkip:
+	case UnknownNationalityDefault:
+		if !IsValidEthnic(string(options.DefaultEthnic)) {
+			return fmt.Errorf(`default ethnic "%s" is not valid ethnic`, options.DefaultEthnic)
+		}
+	default:
+		return fmt.Errorf(`unknown nationality policy "%s" is not one of %s, %s or %s`, options.UnknownNationality, UnknownNationalityFail, UnknownNationalitySkip, UnknownNationalityDefault)
+	}
+
+	switch options.Role {
+	case "", RolePlayer, RoleStaff:
+	default:
+		return fmt.Errorf(`role "%s" is not one of %s or %s`, options.Role, RolePlayer, RoleStaff)
+	}
+	return nil
+}
+
+// UnknownNationality is a country code of the RTF file that has no ethnic
+type UnknownNationality struct {
+	Code     string     `json:"code"`
+	Count    int        `json:"count"`
+	Examples []PlayerID `json:"examples"`
+}
+
+type unknownNationalities map[string]*UnknownNationality
+
+func (unknowns unknownNationalities) add(code string, id PlayerID) {
+	unknown, ok := unknowns[code]
+	if !ok {
+		unknown = &UnknownNationality{Code: code, Examples: make([]PlayerID, 0, unknownNationalityExamples)}
+		unknowns[code] = unknown
+	}
+
+	unknown.Count++
+	if len(unknown.Examples) < unknownNationalityExamples {
+		unknown.Examples = append(unknown.Examples, id)
+	}
+}
+
+// sorted lists the most common unknown nationalities first
+func (unknowns unknownNationalities) sorted() []UnknownNationality {
+	sorted := make([]UnknownNationality, 0, len(unknowns))
+	for _, unknown := range unknowns {
+		sorted = append(sorted, *unknown)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Count != sorted[j].Count {
+			return sorted[i].Count > sorted[j].Count
+		}
+		return sorted[i].Code < sorted[j].Code
+	})
+	return sorted
+}
+
+func (unknown UnknownNationality) String() string {
+	examples := make([]string, len(unknown.Examples))
+	for i, id := range unknown.Examples {
+		examples[i] = string(id)
+	}
+	return fmt.Sprintf("%s (%d player(s), ex: %s)", unknown.Code, unknown.Count, strings.Join(examples, ", "))
+}
+
 func getEthnic(nationality1, nationality2 string, ethnicValue int) (Ethnic, error) {
 	ethnic1, ok := NationEthnicMapping[nationality1]
 	if !ok {
-		return "", fmt.Errorf("ethnic not found for country initials: %s", nationality1)
+		return "", fmt.Errorf("%w: %s", ErrUnknownNationality, nationality1)
 	}
 
-	ethnic2 := NationEthnicMapping[nationality2]
+	return resolveEthnic(nationality1, nationality2, ethnic1, ethnicValue)
+}
 
-	hasEthnic := func(ethnic Ethnic) bool {
-		return ethnic1 == ethnic || ethnic2 == ethnic
+// getEthnicOrDefault resolves a nationality that has no ethnic as the default
+// ethnic, so that the ethnic rules still apply
+func getEthnicOrDefault(nationality1, nationality2 string, ethnicValue int, defaultEthnic Ethnic) (Ethnic, error) {
+	ethnic1, ok := NationEthnicMapping[nationality1]
+	if !ok {
+		ethnic1 = defaultEthnic
 	}
 
-	switch ethnicValue {
-	case 0:
-		if hasEthnic(Scandinavian) {
-			return Scandinavian, nil
-		}
-		if hasEthnic(Caucasian) {
-			return Caucasian, nil
-		}
-		return CentralEuropean, nil
-	case 1:
-		if hasEthnic(Scandinavian) ||
-			hasEthnic(SouthEastAsian) ||
-			hasEthnic(CentralEuropean) ||
-			hasEthnic(Caucasian) ||
-			hasEthnic(African) ||
-			hasEthnic(Asian) ||
-			hasEthnic(MiddleEastNorthAfrican) ||
-			hasEthnic(MiddleEastSouthAsian) ||
-			hasEthnic(EasternEuropeanCentralAsian) {
-			return SouthAmerican, nil
-		}
-		if ethnic1 != "" {
-			return ethnic1, nil
-		}
-		return ethnic2, nil
-	case 2:
-		if hasEthnic(MiddleEastSouthAsian) {
-			return MiddleEastSouthAsian, nil
-		}
-		return MiddleEastNorthAfrican, nil
-	case 3, 6, 7, 8, 9:
-		if ethnicValue == 7 {
-			if ethnic1 == SouthAmericanMediterranean {
-				return SouthAmericanMediterranean, nil
-			}
-			if ethnic1 == SouthAmerican {
-				return SouthAmerican, nil
-			}
-		}
-		return African, nil
-	case 4:
-		return MiddleEastSouthAsian, nil
-	case 5:
-		return SouthEastAsian, nil
-	case 10:
-		if ethnic1 == SouthAmerican {
-			return SouthAmerican, nil
+	return resolveEthnic(nationality1, nationality2, ethnic1, ethnicValue)
+}
+
+func resolveEthnic(nationality1, nationality2 string, ethnic1 Ethnic, ethnicValue int) (Ethnic, error) {
+	ethnic2 := NationEthnicMapping[nationality2]
+
+	for _, rule := range EthnicRules {
+		if ethnic, ok := rule.resolve(nationality1, nationality2, ethnic1, ethnic2, ethnicValue); ok {
+			return ethnic, nil
 		}
-		return Asian, nil
-	default:
-		return "", fmt.Errorf("ethnic value not found: %d", ethnicValue)
 	}
+
+	return "", fmt.Errorf("ethnic value not found: %d", ethnicValue)
 }
 
-func GetPlayers(rtfPath string) ([]Player, error) {
-	players := make([]Player, 0)
+func GetPeople(rtfPath string) ([]Person, error) {
+	players, _, err := ReadPeople(rtfPath, ReadOptions{})
+	return players, err
+}
+
+// ReadPeople reads the players and staff of the RTF file. People with a
+// nationality that has no ethnic fail the whole file, unless the options skip
+// them or give them the default ethnic. Either way they are reported, grouped
+// by country code.
+func ReadPeople(rtfPath string, options ReadOptions) ([]Person, []UnknownNationality, error) {
+	if err := ValidateReadOptions(options); err != nil {
+		return nil, nil, err
+	}
+
+	defaultRole := options.Role
+	if defaultRole == "" {
+		defaultRole = RolePlayer
+	}
+	date := options.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	players := make([]Person, 0)
 
 	rtfFile, rtfErr := os.Open(rtfPath)
 	if rtfErr != nil {
-		return nil, rtfErr
+		return nil, nil, rtfErr
 	}
 	defer rtfFile.Close()
 
-	UIDRegex := regexp.MustCompile("([0-9]){7,}")
+	var header rtfHeader
 
 	getEthnicErrors := make([]error, 0)
+	unknowns := make(unknownNationalities)
 
 	rtfScanner := bufio.NewScanner(rtfFile)
 	for rtfScanner.Scan() {
 		rtfLine := rtfScanner.Text()
-		uidByte := UIDRegex.Find([]byte(rtfLine))
+		if !strings.Contains(rtfLine, "|") {
+			continue
+		}
 
-		if uidByte != nil {
-			id := string(uidByte)
+		rtfData := splitRTFRow(rtfLine)
 
-			rtfData := strings.Split(rtfLine, "|")
-			if len(rtfData) < 8 {
-				return nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("not enough lines in RTF line: %s", rtfLine))
+		if header == nil {
+			if !isRTFHeaderRow(rtfData) {
+				continue
 			}
 
-			for rtfDataIndex := range rtfData {
-				rtfData[rtfDataIndex] = strings.Trim(rtfData[rtfDataIndex], " ")
+			var headerErr error
+			header, headerErr = parseRTFHeader(rtfData)
+			if headerErr != nil {
+				return nil, nil, fmt.Errorf(ErrBadRTFFormat, headerErr)
 			}
+			continue
+		}
 
-			ethnicValue, ethniceValueErr := strconv.Atoi(rtfData[7])
-			if ethniceValueErr != nil {
-				return nil, ethniceValueErr
+		id := header.get(rtfData, columnUID)
+		if !rtfUIDRegex.MatchString(id) {
+			continue // row separators and blank rows
+		}
+
+		if len(rtfData) < header.width() {
+			return nil, nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("not enough columns in RTF line: %s", rtfLine))
+		}
+
+		ethnicValue, ethniceValueErr := strconv.Atoi(header.get(rtfData, columnEthnicity))
+		if ethniceValueErr != nil {
+			return nil, nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("invalid ethnicity value for player %s: %w", id, ethniceValueErr))
+		}
+
+		nationality1 := header.get(rtfData, columnNationality)
+		nationality2 := header.get(rtfData, columnSecondNationality)
+
+		if _, ok := NationEthnicMapping[nationality1]; !ok {
+			unknowns.add(nationality1, PlayerID(id))
+			if options.UnknownNationality != UnknownNationalityDefault {
+				continue
 			}
+		}
 
-			nationality1 := rtfData[2]
-			nationality2 := rtfData[3]
+		ethnic, err := getEthnicOrDefault(nationality1, nationality2, ethnicValue, options.DefaultEthnic)
+		if err != nil {
+			getEthnicErrors = append(getEthnicErrors, err)
+			continue
+		}
 
-			ethnic, err := getEthnic(nationality1, nationality2, ethnicValue)
+		skinTone := 0
+		if skinToneValue := header.get(rtfData, columnSkinTone); skinToneValue != "" {
+			skinTone, err = strconv.Atoi(skinToneValue)
 			if err != nil {
-				getEthnicErrors = append(getEthnicErrors, err)
-				continue
+				return nil, nil, fmt.Errorf(ErrBadRTFFormat, fmt.Errorf("invalid skin tone value for player %s: %w", id, err))
 			}
+		}
 
-			players = append(players, Player{
-				ID:     PlayerID(id),
-				Ethnic: ethnic,
-			})
+		ageValue := header.get(rtfData, columnAge)
+		if ageValue == "" {
+			ageValue = header.get(rtfData, columnDateOfBirth)
+		}
+		// an age that cannot be read is left unknown instead of failing the file
+		ageInvalid := ""
+		age, ageCounted, err := parseAge(ageValue, date)
+		if err != nil {
+			age, ageCounted, ageInvalid = 0, false, ageValue
 		}
-	}
 
-	if len(getEthnicErrors) > 0 {
-		return nil, fmt.Errorf(ErrBadRTFFormat, errors.Join(getEthnicErrors...))
+		players = append(players, Person{
+			ID:         PlayerID(id),
+			Ethnic:     ethnic,
+			SkinTone:   skinTone,
+			Age:        age,
+			AgeCounted: ageCounted,
+			AgeInvalid: ageInvalid,
+			Role:       parseRole(header.get(rtfData, columnRole), defaultRole),
+		})
 	}
 
 	if rtfScannerErr := rtfScanner.Err(); rtfScannerErr != nil {
-		return nil, rtfScannerErr
+		return nil, nil, rtfScannerErr
+	}
+
+	if header == nil {
+		return nil, nil, fmt.Errorf(ErrBadRTFFormat, errors.New("header row with a UID column not found"))
+	}
+
+	unknownList := unknowns.sorted()
+	if len(unknownList) > 0 && (options.UnknownNationality == "" || options.UnknownNationality == UnknownNationalityFail) {
+		codes := make([]string, len(unknownList))
+		for i, unknown := range unknownList {
+			codes[i] = unknown.String()
+		}
+		getEthnicErrors = append(getEthnicErrors, fmt.Errorf("%w: %s", ErrUnknownNationality, strings.Join(codes, "; ")))
+	}
+
+	if len(getEthnicErrors) > 0 {
+		return nil, unknownList, fmt.Errorf(ErrBadRTFFormat, errors.Join(getEthnicErrors...))
 	}
 
-	return players, nil
+	return players, unknownList, nil
 }
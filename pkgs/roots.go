@@ -0,0 +1,60 @@
+package mapper
+
+import (
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// ImageRoot is one image directory of a layered facepack, ex: a base
+// facepack and a smaller add-on pack on top of it
+type ImageRoot struct {
+	Path     string
+	Priority int    // images replace the images with the same path in roots with a lower priority
+	From     string // path from the xml file to the image directory, written in front of its images
+}
+
+// SortImageRoots orders roots from the highest priority to the lowest, roots
+// with the same priority keep their order
+func SortImageRoots(roots []ImageRoot) []ImageRoot {
+	sorted := slices.Clone(roots)
+	slices.SortStableFunc(sorted, func(a, b ImageRoot) int {
+		return b.Priority - a.Priority
+	})
+	return sorted
+}
+
+// Roots are the image roots of the pool, highest priority first
+func (images *ImagePool) Roots() []ImageRoot {
+	return images.roots
+}
+
+// Root is the image root an image of the pool comes from
+func (images *ImagePool) Root(ethnic Ethnic, imagePath FilePath) (ImageRoot, bool) {
+	rootIndex, ok := images.origins[ethnic][imagePath]
+	if !ok {
+		return ImageRoot{}, false
+	}
+	return images.roots[rootIndex], true
+}
+
+// FromPath is the path written to the xml file for an image of the pool,
+// relative to the xml file through the root the image comes from
+func (images *ImagePool) FromPath(ethnic Ethnic, imagePath FilePath) FilePath {
+	root, ok := images.Root(ethnic, imagePath)
+	if !ok {
+		root = images.roots[0]
+	}
+	return FilePath(path.Join(root.From, string(ethnic), string(imagePath)))
+}
+
+// FindImage looks for an image path inside the image roots, ex:
+// African/image, and returns the root with the highest priority that has it
+func FindImage(roots []ImageRoot, imagePath FilePath) (ImageRoot, bool) {
+	for _, root := range SortImageRoots(roots) {
+		if ImageExists(filepath.Join(root.Path, filepath.FromSlash(string(imagePath)))) {
+			return root, true
+		}
+	}
+	return ImageRoot{}, false
+}
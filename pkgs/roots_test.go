@@ -0,0 +1,61 @@
+package mapper
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewLayeredImagePool_HigherPriorityReplacesImage(t *testing.T) {
+	base, addon := t.TempDir(), t.TempDir()
+	writeImages(t, base, "African/a.png", "African/b.png")
+	writeImages(t, addon, "African/b.png", "African/c.png", "Asian/d.png")
+
+	roots := []ImageRoot{
+		{Path: base, From: "faces"},
+		{Path: addon, Priority: 1, From: "../addon"},
+	}
+	imagePool, err := NewLayeredImagePool(roots, ImagePoolOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if total := imagePool.Total(African); total != 3 {
+		t.Fatalf("expected 3 African images, got %d", total)
+	}
+	if imagePool.HasEthnic(Caucasian) || !imagePool.HasEthnic(Asian) {
+		t.Fatalf("expected only the ethnics of any root to be found, got missing %v", imagePool.MissingEthnics())
+	}
+
+	fromPaths := []FilePath{
+		imagePool.FromPath(African, "a"),
+		imagePool.FromPath(African, "b"),
+		imagePool.FromPath(African, "c"),
+		imagePool.FromPath(Asian, "d"),
+	}
+	expected := []FilePath{"faces/African/a", "../addon/African/b", "../addon/African/c", "../addon/Asian/d"}
+	if !slices.Equal(fromPaths, expected) {
+		t.Fatalf("expected %v, got %v", expected, fromPaths)
+	}
+}
+
+func TestFindImage_HighestPriority(t *testing.T) {
+	base, addon := t.TempDir(), t.TempDir()
+	writeImages(t, base, "African/a.png", "African/b.png")
+	writeImages(t, addon, "African/b.png")
+
+	roots := []ImageRoot{{Path: base}, {Path: addon, Priority: 1}}
+
+	root, ok := FindImage(roots, "African/b")
+	if !ok || root.Path != addon {
+		t.Fatalf("expected African/b from %s, got %v", addon, root)
+	}
+
+	root, ok = FindImage(roots, "African/a")
+	if !ok || root.Path != base {
+		t.Fatalf("expected African/a from %s, got %v", base, root)
+	}
+
+	if _, ok := FindImage(roots, "African/missing"); ok {
+		t.Fatal("expected a missing image not to be found")
+	}
+}
@@ -0,0 +1,160 @@
+package mapper
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type rtfColumn string
+
+const (
+	columnUID               rtfColumn = "UID"
+	columnNationality       rtfColumn = "Nat"
+	columnSecondNationality rtfColumn = "2nd Nat"
+	columnName              rtfColumn = "Name"
+	columnSkinTone          rtfColumn = "Skin Tone"
+	columnEthnicity         rtfColumn = "Ethnicity"
+	columnRole              rtfColumn = "Job"
+	columnAge               rtfColumn = "Age"
+	columnDateOfBirth       rtfColumn = "DoB"
+)
+
+// header titles are matched case insensitively
+var rtfColumnAliases = map[string]rtfColumn{
+	"uid":                columnUID,
+	"unique id":          columnUID,
+	"nat":                columnNationality,
+	"nationality":        columnNationality,
+	"2nd nat":            columnSecondNationality,
+	"second nationality": columnSecondNationality,
+	"name":               columnName,
+	"skin tone":          columnSkinTone,
+	"skin":               columnSkinTone,
+	"ethnicity":          columnEthnicity,
+	"ethnic":             columnEthnicity,
+	"job":                columnRole,
+	"role":               columnRole,
+	"staff role":         columnRole,
+	"age":                columnAge,
+	"dob":                columnDateOfBirth,
+	"date of birth":      columnDateOfBirth,
+	"born":               columnDateOfBirth,
+}
+
+var requiredRTFColumns = []rtfColumn{
+	columnUID,
+	columnNationality,
+	columnSecondNationality,
+	columnEthnicity,
+}
+
+// The stock PlayerSearch view exports its last columns without a title. Any
+// column in this list that isn't found by title is taken from the untitled
+// columns, starting from the rightmost one.
+var untitledRTFColumns = []rtfColumn{
+	columnEthnicity,
+	columnSkinTone,
+}
+
+var rtfUIDRegex = regexp.MustCompile(`^[0-9]+$`)
+
+type rtfHeader map[rtfColumn]int // ex: UID => 0
+
+func splitRTFRow(rtfLine string) []string {
+	rtfLine = strings.TrimSpace(rtfLine)
+	rtfLine = strings.TrimPrefix(rtfLine, "|")
+	rtfLine = strings.TrimSuffix(rtfLine, "|")
+
+	cells := strings.Split(rtfLine, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+
+	return cells
+}
+
+func isRTFHeaderRow(cells []string) bool {
+	for _, cell := range cells {
+		if rtfColumnAliases[strings.ToLower(cell)] == columnUID {
+			return true
+		}
+	}
+	return false
+}
+
+func parseRTFHeader(cells []string) (rtfHeader, error) {
+	header := make(rtfHeader)
+	untitled := make([]int, 0)
+
+	for index, title := range cells {
+		if title == "" {
+			untitled = append(untitled, index)
+			continue
+		}
+
+		column, ok := rtfColumnAliases[strings.ToLower(title)]
+		if !ok {
+			continue // extra columns are allowed
+		}
+
+		if _, duplicate := header[column]; duplicate {
+			return nil, fmt.Errorf("column %q appears more than once in the RTF header", column)
+		}
+		header[column] = index
+	}
+
+	for _, column := range untitledRTFColumns {
+		if _, ok := header[column]; ok {
+			continue
+		}
+		if len(untitled) == 0 {
+			break
+		}
+		header[column] = untitled[len(untitled)-1]
+		untitled = untitled[:len(untitled)-1]
+	}
+
+	missing := make([]string, 0)
+	for _, column := range requiredRTFColumns {
+		if _, ok := header[column]; !ok {
+			missing = append(missing, string(column))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("RTF header is missing required column(s): %s", strings.Join(missing, ", "))
+	}
+
+	return header, nil
+}
+
+// parseRole reads the job column of a staff search, every job but player is
+// staff. Rows without a job have the default role.
+func parseRole(value string, defaultRole Role) Role {
+	switch strings.ToLower(value) {
+	case "":
+		return defaultRole
+	case "player", "players":
+		return RolePlayer
+	default:
+		return RoleStaff
+	}
+}
+
+func (header rtfHeader) width() int {
+	width := 0
+	for _, index := range header {
+		if index+1 > width {
+			width = index + 1
+		}
+	}
+	return width
+}
+
+func (header rtfHeader) get(cells []string, column rtfColumn) string {
+	index, ok := header[column]
+	if !ok || index >= len(cells) {
+		return ""
+	}
+	return cells[index]
+}
@@ -0,0 +1,195 @@
+package mapper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTempFile writes content to a file named name in a new temp folder
+func writeTempFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("could not write %s: %v", name, err)
+	}
+
+	return filePath
+}
+
+func TestParseRTFHeader_StockView(t *testing.T) {
+	header, err := parseRTFHeader(splitRTFRow("| UID       | Nat       | 2nd Nat   | Name        |           |           |           | "))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := rtfHeader{
+		columnUID:               0,
+		columnNationality:       1,
+		columnSecondNationality: 2,
+		columnName:              3,
+		columnSkinTone:          5,
+		columnEthnicity:         6,
+	}
+	for column, index := range expected {
+		if header[column] != index {
+			t.Fatalf("expected column %q at %d, got %d", column, index, header[column])
+		}
+	}
+}
+
+func TestParseRTFHeader_ReorderedAndExtraColumns(t *testing.T) {
+	header, err := parseRTFHeader(splitRTFRow("| Name | Club | Ethnicity | 2nd Nat | Nat | UID |"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if header[columnUID] != 5 || header[columnNationality] != 4 || header[columnSecondNationality] != 3 || header[columnEthnicity] != 2 {
+		t.Fatalf("columns were not mapped by name: %v", header)
+	}
+}
+
+func TestParseRTFHeader_MissingColumn(t *testing.T) {
+	_, err := parseRTFHeader(splitRTFRow("| UID | 2nd Nat | Name | Ethnicity |"))
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	expectedErrorMsg := "RTF header is missing required column(s): Nat"
+	if err.Error() != expectedErrorMsg {
+		t.Fatalf("expected error message to be %q, got %q", expectedErrorMsg, err.Error())
+	}
+}
+
+func TestGetPeople_ReorderedColumns(t *testing.T) {
+	rtfPath := writeTempFile(t, "newgen.rtf", "| Ethnicity | Name | UID | Nat | 2nd Nat |\r\n"+
+		"| --------------------------------------|\r\n"+
+		"| 3         | Isaac Ngoy | 2000133376 | FRA | COD |\r\n"+
+		"| --------------------------------------|\r\n"+
+		"| 0         | Tomeu | 2000134233 | ESP |  |\r\n")
+
+	players, err := GetPeople(rtfPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(players) != 2 {
+		t.Fatalf("expected 2 players, got %d", len(players))
+	}
+	if players[0].ID != "2000133376" || players[0].Ethnic != African {
+		t.Fatalf("unexpected first player: %+v", players[0])
+	}
+	if players[1].ID != "2000134233" || players[1].Ethnic != CentralEuropean {
+		t.Fatalf("unexpected second player: %+v", players[1])
+	}
+}
+
+func TestReadPeople_UnknownNationality(t *testing.T) {
+	rtfPath := writeTempFile(t, "newgen.rtf", "| UID | Nat | 2nd Nat | Ethnicity |\r\n"+
+		"| 1 | XYZ |  | 0 |\r\n"+
+		"| 2 | FRA |  | 3 |\r\n"+
+		"| 3 | XYZ |  | 0 |\r\n"+
+		"| 4 | QQQ |  | 0 |\r\n")
+
+	players, unknowns, err := ReadPeople(rtfPath, ReadOptions{})
+	if !errors.Is(err, ErrUnknownNationality) || players != nil {
+		t.Fatalf("expected ErrUnknownNationality and no players, got %v, %v", err, players)
+	}
+	if len(unknowns) != 2 || unknowns[0].Code != "XYZ" || unknowns[0].Count != 2 || len(unknowns[0].Examples) != 2 {
+		t.Fatalf("expected XYZ twice then QQQ, got %+v", unknowns)
+	}
+
+	players, _, err = ReadPeople(rtfPath, ReadOptions{UnknownNationality: UnknownNationalitySkip})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(players) != 1 || players[0].ID != "2" {
+		t.Fatalf("expected only the known player, got %+v", players)
+	}
+
+	players, _, err = ReadPeople(rtfPath, ReadOptions{UnknownNationality: UnknownNationalityDefault, DefaultEthnic: Caucasian})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(players) != 4 || players[0].Ethnic != Caucasian {
+		t.Fatalf("expected every player with the default ethnic for unknown ones, got %+v", players)
+	}
+
+	if _, _, err := ReadPeople(rtfPath, ReadOptions{UnknownNationality: UnknownNationalityDefault}); err == nil {
+		t.Fatal("expected an error for a missing default ethnic but got none")
+	}
+}
+
+func TestReadPeople_StaffRoles(t *testing.T) {
+	rtfPath := writeTempFile(t, "newgen.rtf", "| UID | Nat | 2nd Nat | Job | Ethnicity |\r\n"+
+		"| 1 | FRA |  | Head Coach | 3 |\r\n"+
+		"| 2 | FRA |  | Player | 3 |\r\n"+
+		"| 3 | FRA |  |  | 3 |\r\n")
+
+	people, _, err := ReadPeople(rtfPath, ReadOptions{Role: RoleStaff})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []Role{RoleStaff, RolePlayer, RoleStaff}
+	for i, person := range people {
+		if person.Role != expected[i] {
+			t.Fatalf("expected person %s to be %s, got %s", person.ID, expected[i], person.Role)
+		}
+	}
+
+	people, err = GetPeople(rtfPath)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if people[2].Role != RolePlayer {
+		t.Fatalf("expected people without a job to be players by default, got %s", people[2].Role)
+	}
+
+	if _, _, err := ReadPeople(rtfPath, ReadOptions{Role: "coach"}); err == nil {
+		t.Fatal("expected an error for an unknown role but got none")
+	}
+}
+
+func TestReadPeople_AgeAndDateOfBirth(t *testing.T) {
+	rtfPath := writeTempFile(t, "newgen.rtf", "| UID | Nat | 2nd Nat | DoB | Ethnicity |\r\n"+
+		"| 1 | FRA |  | 1/1/2010 (20 years old) | 3 |\r\n"+
+		"| 2 | FRA |  | 1/7/2000 | 3 |\r\n"+
+		"| 3 | FRA |  |  | 3 |\r\n")
+
+	people, _, err := ReadPeople(rtfPath, ReadOptions{Date: time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	expected := []int{20, 29, 0}
+	for i, person := range people {
+		if person.Age != expected[i] {
+			t.Fatalf("expected person %s to be %d, got %d", person.ID, expected[i], person.Age)
+		}
+	}
+}
+
+func TestReadPeople_UnreadableDateOfBirth(t *testing.T) {
+	rtfPath := writeTempFile(t, "newgen.rtf", "| UID | Nat | 2nd Nat | DoB | Ethnicity |\r\n"+
+		"| 1 | FRA |  | 12/31/2006 | 3 |\r\n"+
+		"| 2 | FRA |  | 1/7/2000 | 3 |\r\n")
+
+	people, _, err := ReadPeople(rtfPath, ReadOptions{Date: time.Date(2030, time.June, 1, 0, 0, 0, 0, time.UTC)})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(people) != 2 {
+		t.Fatalf("expected both people to be read, got %v", people)
+	}
+	if people[0].Age != 0 || people[0].AgeCounted || people[0].AgeInvalid != "12/31/2006" {
+		t.Fatalf("expected the month first date to leave the age unknown, got %+v", people[0])
+	}
+	if people[1].Age != 29 || people[1].AgeInvalid != "" {
+		t.Fatalf("expected the day first date to be read, got %+v", people[1])
+	}
+}
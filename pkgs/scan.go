@@ -0,0 +1,217 @@
+package mapper
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type ImageValidation string
+
+const (
+	ValidateNone   ImageValidation = "none"
+	ValidateHeader ImageValidation = "header" // decode the image header only
+	ValidateDecode ImageValidation = "decode" // decode the whole image, catches truncated files
+)
+
+type ImagePoolOptions struct {
+	Recursive  bool            // scan every nested folder of an ethnic folder, not just skin tone buckets
+	Include    []string        // glob patterns, when set images have to match one of them
+	Exclude    []string        // glob patterns of images and folders to skip, ex: _thumbs
+	Extensions []string        // allowed file extensions without the dot, any extension when empty
+	Validation ImageValidation // no validation when empty
+}
+
+// InvalidImage is a file that was left out of the image pool
+type InvalidImage struct {
+	Root   string `json:"root"`
+	Ethnic Ethnic `json:"ethnic"`
+	Path   string `json:"path"` // relative to the ethnic folder, with extension
+	Reason string `json:"reason"`
+}
+
+func (options ImagePoolOptions) validate() error {
+	for _, patterns := range [][]string{options.Include, options.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("bad image pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	switch options.Validation {
+	case "", ValidateNone, ValidateHeader, ValidateDecode:
+	default:
+		return fmt.Errorf(`image validation "%s" is not one of %s, %s or %s`, options.Validation, ValidateNone, ValidateHeader, ValidateDecode)
+	}
+
+	return nil
+}
+
+func hasExtension(extensions []string, filename string) bool {
+	if len(extensions) == 0 {
+		return true
+	}
+
+	extension := strings.TrimPrefix(path.Ext(filename), ".")
+	for _, allowed := range extensions {
+		if strings.EqualFold(strings.TrimPrefix(allowed, "."), extension) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateImageFile(filePath string, validation ImageValidation) error {
+	if validation == "" || validation == ValidateNone {
+		return nil
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if validation == ValidateDecode {
+		_, _, err = image.Decode(file)
+	} else {
+		_, _, err = image.DecodeConfig(file)
+	}
+	return err
+}
+
+// matchesPattern matches a glob pattern against the path relative to the
+// ethnic folder, and against the file or folder name alone
+func matchesPattern(patterns []string, relativePath string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, relativePath); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, path.Base(relativePath)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// skinToneOfFolder returns the skin tone of the innermost skin tone bucket in
+// a folder path relative to the ethnic folder
+func skinToneOfFolder(relativeFolder string) *skinToneRange {
+	if relativeFolder == "." {
+		return nil
+	}
+
+	folders := strings.Split(relativeFolder, "/")
+	for i := len(folders) - 1; i >= 0; i-- {
+		if skinTone := parseSkinToneBucket(folders[i]); skinTone != nil {
+			return skinTone
+		}
+	}
+	return nil
+}
+
+// SkinToneOfImage returns a skin tone of the skin tone bucket of an image path
+// relative to the ethnic folder, ex: 6 for 6-10/face, or 0 when the image is
+// not in a bucket
+func SkinToneOfImage(imagePath FilePath) int {
+	skinTone := skinToneOfFolder(path.Dir(string(imagePath)))
+	if skinTone == nil {
+		return 0
+	}
+	return skinTone.min
+}
+
+// isBucketFolder tells whether a folder relative to the ethnic folder is the
+// staff folder, a skin tone bucket, an age band or a mix of them, ex: staff,
+// 1-5, staff/1-5 or 1-5/age16-21
+func isBucketFolder(relativePath string) bool {
+	if relativePath == StaffFolder {
+		return true
+	}
+
+	for _, folder := range strings.Split(strings.TrimPrefix(relativePath, StaffFolder+"/"), "/") {
+		if parseSkinToneBucket(folder) == nil && parseAgeBandFolder(folder) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func scanEthnicFolder(ethnicPath string, options ImagePoolOptions) ([]poolImage, []InvalidImage, error) {
+	ethnicPool := make([]poolImage, 0)
+	invalidImages := make([]InvalidImage, 0)
+	stems := make(map[FilePath]string) // ex: image => image.png
+
+	err := filepath.WalkDir(ethnicPath, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(ethnicPath, filePath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+
+		if entry.IsDir() {
+			if relativePath == "." {
+				return nil
+			}
+			if matchesPattern(options.Exclude, relativePath) {
+				return filepath.SkipDir
+			}
+			// without recursion only skin tone buckets right inside the ethnic
+			// folder or its staff folder are read
+			if !options.Recursive && !isBucketFolder(relativePath) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if matchesPattern(options.Exclude, relativePath) {
+			return nil
+		}
+		if len(options.Include) > 0 && !matchesPattern(options.Include, relativePath) {
+			return nil
+		}
+
+		if !hasExtension(options.Extensions, relativePath) {
+			invalidImages = append(invalidImages, InvalidImage{Path: relativePath, Reason: "extension is not allowed"})
+			return nil
+		}
+
+		if err := validateImageFile(filePath, options.Validation); err != nil {
+			invalidImages = append(invalidImages, InvalidImage{Path: relativePath, Reason: fmt.Sprintf("not a valid image: %s", err)})
+			return nil
+		}
+
+		// football manager requires filenames but not filename.png
+		imagePath := FilePath(strings.TrimSuffix(relativePath, path.Ext(relativePath)))
+
+		if duplicate, ok := stems[imagePath]; ok {
+			invalidImages = append(invalidImages, InvalidImage{Path: relativePath, Reason: fmt.Sprintf("same name as %s", duplicate)})
+			return nil
+		}
+		stems[imagePath] = relativePath
+
+		ethnicPool = append(ethnicPool, poolImage{
+			path:     imagePath,
+			file:     relativePath,
+			skinTone: skinToneOfFolder(path.Dir(relativePath)),
+			age:      ageBandOfImage(relativePath),
+			staff:    strings.HasPrefix(relativePath, StaffFolder+"/"),
+		})
+
+		return nil
+	})
+
+	return ethnicPool, invalidImages, err
+}
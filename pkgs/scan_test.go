@@ -0,0 +1,145 @@
+package mapper
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func scannedPaths(t *testing.T, options ImagePoolOptions, relativePaths ...string) []FilePath {
+	t.Helper()
+
+	root := t.TempDir()
+	writeImages(t, root, relativePaths...)
+
+	ethnicPool, _, err := scanEthnicFolder(root, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	paths := make([]FilePath, 0, len(ethnicPool))
+	for _, image := range ethnicPool {
+		paths = append(paths, image.path)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+func TestScanEthnicFolder_NotRecursive(t *testing.T) {
+	paths := scannedPaths(t, ImagePoolOptions{}, "a.png", "batch1/b.png", "1-5/c.png", "1-5/nested/d.png")
+
+	expected := []FilePath{"1-5/c", "a"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestScanEthnicFolder_StaffFolder(t *testing.T) {
+	paths := scannedPaths(t, ImagePoolOptions{}, "a.png", "staff/b.png", "staff/1-5/c.png", "staff/old/d.png", "staff/staff/e.png")
+
+	expected := []FilePath{"a", "staff/1-5/c", "staff/b"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestSkinToneOfImage_Bucket(t *testing.T) {
+	cases := map[FilePath]int{
+		"face":                 0,
+		"6-10/face":            6,
+		"20/face":              20,
+		"staff/1-5/age30+/old": 1,
+		"age16-21/face":        0,
+	}
+
+	for imagePath, expected := range cases {
+		if skinTone := SkinToneOfImage(imagePath); skinTone != expected {
+			t.Fatalf("expected %q to have skin tone %d, got %d", imagePath, expected, skinTone)
+		}
+	}
+}
+
+func TestScanEthnicFolder_RecursiveWithPatterns(t *testing.T) {
+	options := ImagePoolOptions{
+		Recursive: true,
+		Include:   []string{"*.png"},
+		Exclude:   []string{"_thumbs", "unused"},
+	}
+	paths := scannedPaths(t, options,
+		"a.png",
+		"batch1/b.png",
+		"batch1/readme.txt",
+		"batch1/_thumbs/b.png",
+		"unused/c.png",
+		"batch2/6-10/d.png",
+	)
+
+	expected := []FilePath{"a", "batch1/b", "batch2/6-10/d"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestNewImagePool_BadPattern(t *testing.T) {
+	if _, err := NewImagePool(t.TempDir(), ImagePoolOptions{Exclude: []string{"["}}); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
+
+func TestScanEthnicFolder_Validation(t *testing.T) {
+	root := t.TempDir()
+	writeImages(t, root, "empty.png", "notes.txt")
+
+	var valid bytes.Buffer
+	if err := png.Encode(&valid, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("could not encode png: %v", err)
+	}
+	for _, name := range []string{"a.png", "a.jpg", "b.png"} {
+		if err := os.WriteFile(filepath.Join(root, name), valid.Bytes(), 0o644); err != nil {
+			t.Fatalf("could not write image: %v", err)
+		}
+	}
+	truncated := valid.Bytes()[:valid.Len()-12]
+	if err := os.WriteFile(filepath.Join(root, "truncated.png"), truncated, 0o644); err != nil {
+		t.Fatalf("could not write image: %v", err)
+	}
+
+	options := ImagePoolOptions{
+		Extensions: []string{"png", "jpg"},
+		Validation: ValidateDecode,
+	}
+	ethnicPool, invalidImages, err := scanEthnicFolder(root, options)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	paths := make([]FilePath, 0, len(ethnicPool))
+	for _, image := range ethnicPool {
+		paths = append(paths, image.path)
+	}
+	slices.Sort(paths)
+	expected := []FilePath{"a", "b"}
+	if !slices.Equal(paths, expected) {
+		t.Fatalf("expected %v, got %v", expected, paths)
+	}
+
+	invalidPaths := make([]string, 0, len(invalidImages))
+	for _, invalidImage := range invalidImages {
+		invalidPaths = append(invalidPaths, invalidImage.Path)
+	}
+	slices.Sort(invalidPaths)
+	expectedInvalid := []string{"a.png", "empty.png", "notes.txt", "truncated.png"}
+	if !slices.Equal(invalidPaths, expectedInvalid) {
+		t.Fatalf("expected invalid %v, got %v", expectedInvalid, invalidPaths)
+	}
+}
+
+func TestNewImagePool_BadValidation(t *testing.T) {
+	if _, err := NewImagePool(t.TempDir(), ImagePoolOptions{Validation: "full"}); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
@@ -11,7 +11,22 @@ func IsValidEthnic(ethnic string) bool {
 
 type PlayerID string
 
-type Player struct {
-	ID     PlayerID
-	Ethnic Ethnic
+// Role tells players apart from staff, ex: coaches, scouts and physios
+type Role string
+
+const (
+	RolePlayer Role = "player"
+	RoleStaff  Role = "staff"
+)
+
+// Person is anyone of the RTF file who needs a face, their id is the UID of
+// the game whatever their role
+type Person struct {
+	ID         PlayerID
+	Ethnic     Ethnic
+	SkinTone   int    // 0 when the RTF has no skin tone column
+	Age        int    // 0 when the RTF has no age or date of birth column
+	AgeCounted bool   // the age was counted from a bare date of birth, at ReadOptions.Date
+	AgeInvalid string // the age or date of birth that could not be read, the age is then left unknown
+	Role       Role
 }
@@ -3,6 +3,9 @@ package mapper
 import (
 	"errors"
 	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
 )
 
 func MapValues[M ~map[K]V, K comparable, V any](m M) []V {
@@ -30,3 +33,64 @@ func OverrideNationEthnicMapping(overrides map[string]string) error {
 
 	return nil
 }
+
+// AddEthnicities registers the ethnicities of facepacks that add their own
+// groups. Like the built-in ones, the name of an ethnic is its folder name.
+func AddEthnicities(names []string) error {
+	ethnicErrors := []error{}
+
+	for _, name := range names {
+		switch {
+		case strings.TrimSpace(name) == "":
+			ethnicErrors = append(ethnicErrors, errors.New("ethnic name cannot be empty"))
+		case strings.ContainsAny(name, `/\`) || name == "." || name == "..":
+			ethnicErrors = append(ethnicErrors, fmt.Errorf(`ethnic "%s" has to be a folder name, not a path`, name))
+		case IsValidEthnic(name):
+			ethnicErrors = append(ethnicErrors, fmt.Errorf(`ethnic "%s" already exists`, name))
+		default:
+			Ethnicities = append(Ethnicities, Ethnic(name))
+			EthnicSet.Add(Ethnic(name))
+		}
+	}
+
+	return errors.Join(ethnicErrors...)
+}
+
+type PlayerOverride struct {
+	Image  FilePath // image path inside the image directory, ex: African/image
+	Ethnic Ethnic
+}
+
+// ParsePlayerOverrides reads overrides from a player UID to either an image
+// path inside the image directory or an ethnic
+func ParsePlayerOverrides(overrides map[string]string) (map[PlayerID]PlayerOverride, error) {
+	playerOverrides := make(map[PlayerID]PlayerOverride)
+	overrideErrors := []error{}
+
+	for id, value := range overrides {
+		if !rtfUIDRegex.MatchString(id) {
+			overrideErrors = append(overrideErrors, fmt.Errorf(`player override "%s" is not a valid UID`, id))
+			continue
+		}
+
+		if IsValidEthnic(value) {
+			playerOverrides[PlayerID(id)] = PlayerOverride{Ethnic: Ethnic(value)}
+			continue
+		}
+
+		image := FilePath(strings.TrimSuffix(path.Clean(filepath.ToSlash(value)), path.Ext(value)))
+		ethnic, _, ok := SplitEthnicImagePath(image)
+		if !ok {
+			overrideErrors = append(overrideErrors, fmt.Errorf(`player override "%s" for "%s" is neither an ethnic nor an image inside an ethnic folder`, value, id))
+			continue
+		}
+
+		playerOverrides[PlayerID(id)] = PlayerOverride{Image: image, Ethnic: ethnic}
+	}
+
+	if len(overrideErrors) > 0 {
+		return nil, errors.Join(overrideErrors...)
+	}
+
+	return playerOverrides, nil
+}
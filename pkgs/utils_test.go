@@ -1,12 +1,18 @@
 package mapper
 
 import (
+	"slices"
 	"testing"
 
 	mapset "github.com/deckarep/golang-set/v2"
 )
 
-func setup() {
+func setup(t *testing.T) {
+	nationEthnicMapping, ethnicSet, ethnicities := NationEthnicMapping, EthnicSet, Ethnicities
+	t.Cleanup(func() {
+		NationEthnicMapping, EthnicSet, Ethnicities = nationEthnicMapping, ethnicSet, ethnicities
+	})
+
 	NationEthnicMapping = make(map[string]Ethnic)
 
 	EthnicSet = mapset.NewSet[Ethnic]()
@@ -16,7 +22,7 @@ func setup() {
 }
 
 func TestOverrideNationEthnicMapping_ValidOverrides(t *testing.T) {
-	setup()
+	setup(t)
 
 	overrides := map[string]string{
 		"USA": "African",
@@ -34,7 +40,7 @@ func TestOverrideNationEthnicMapping_ValidOverrides(t *testing.T) {
 }
 
 func TestOverrideNationEthnicMapping_InvalidOverrides(t *testing.T) {
-	setup()
+	setup(t)
 
 	overrides := map[string]string{
 		"USA": "Caucasian",
@@ -53,7 +59,7 @@ func TestOverrideNationEthnicMapping_InvalidOverrides(t *testing.T) {
 }
 
 func TestOverrideNationEthnicMapping_MixedValidAndInvalid(t *testing.T) {
-	setup()
+	setup(t)
 
 	overrides := map[string]string{
 		"USA": "Caucasian",
@@ -79,7 +85,7 @@ func TestOverrideNationEthnicMapping_MixedValidAndInvalid(t *testing.T) {
 }
 
 func TestOverrideNationEthnicMapping_NoOverrides(t *testing.T) {
-	setup()
+	setup(t)
 
 	overrides := map[string]string{} // empty map
 
@@ -88,3 +94,68 @@ func TestOverrideNationEthnicMapping_NoOverrides(t *testing.T) {
 		t.Fatalf("expected no error, got %v", err)
 	}
 }
+
+func TestParsePlayerOverrides_ImageAndEthnic(t *testing.T) {
+	overrides := map[string]string{
+		"2000133376": "African/1-5/academy_star.png",
+		"2000134233": "Asian",
+	}
+
+	playerOverrides, err := ParsePlayerOverrides(overrides)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if override := playerOverrides["2000133376"]; override.Image != "African/1-5/academy_star" || override.Ethnic != African {
+		t.Fatalf("expected image override, got %+v", override)
+	}
+	if override := playerOverrides["2000134233"]; override.Image != "" || override.Ethnic != Asian {
+		t.Fatalf("expected ethnic override, got %+v", override)
+	}
+}
+
+func TestParsePlayerOverrides_Invalid(t *testing.T) {
+	overrides := map[string]string{
+		"2000133376": "faces/academy_star",
+	}
+
+	_, err := ParsePlayerOverrides(overrides)
+	if err == nil {
+		t.Fatal("expected an error but got none")
+	}
+
+	expectedErrorMsg := `player override "faces/academy_star" for "2000133376" is neither an ethnic nor an image inside an ethnic folder`
+	if err.Error() != expectedErrorMsg {
+		t.Fatalf("expected error message to be %q, got %q", expectedErrorMsg, err.Error())
+	}
+}
+
+func TestAddEthnicities(t *testing.T) {
+	setup(t)
+	Ethnicities = slices.Clone(Ethnicities)
+
+	if err := AddEthnicities([]string{"Pacific Islander"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !IsValidEthnic("Pacific Islander") || !slices.Contains(Ethnicities, "Pacific Islander") {
+		t.Fatal("expected Pacific Islander to be a valid ethnic")
+	}
+
+	if err := OverrideNationEthnicMapping(map[string]string{"SAM": "Pacific Islander"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	root := t.TempDir()
+	writeImages(t, root, "Pacific Islander/a.png")
+	imagePool, err := NewImagePool(root, ImagePoolOptions{})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if total := imagePool.Total("Pacific Islander"); total != 1 {
+		t.Fatalf("expected the Pacific Islander folder to be scanned, got %d images", total)
+	}
+
+	if err := AddEthnicities([]string{"African", "", "Nordic/Sami"}); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
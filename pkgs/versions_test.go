@@ -0,0 +1,65 @@
+package mapper
+
+import "testing"
+
+func TestLookupFMVersion_Aliases(t *testing.T) {
+	for _, version := range []string{"2024", "24", "FM24", "fm24"} {
+		fmVersion, err := LookupFMVersion(version)
+		if err != nil {
+			t.Fatalf("expected no error for %q, got %v", version, err)
+		}
+		if fmVersion.Name != "2024" {
+			t.Fatalf("expected %q to be 2024, got %q", version, fmVersion.Name)
+		}
+	}
+}
+
+func TestLookupFMVersion_Unknown(t *testing.T) {
+	if _, err := LookupFMVersion("2020"); err == nil {
+		t.Fatal("expected an error but got none")
+	}
+}
+
+func TestFMVersion_ToPathRoundTrip(t *testing.T) {
+	cases := map[string]string{
+		"2023": "graphics/pictures/person/2000133376/portrait",
+		"2024": "graphics/pictures/person/r-2000133376/portrait",
+		"2026": "graphics/pictures/person/r-2000133376/portrait",
+	}
+
+	for version, toPath := range cases {
+		fmVersion, _ := LookupFMVersion(version)
+
+		if fmVersion.ToPath("2000133376") != toPath {
+			t.Fatalf("expected %s to path to be %q, got %q", version, toPath, fmVersion.ToPath("2000133376"))
+		}
+
+		id, ok := fmVersion.PlayerID(toPath)
+		if !ok || id != "2000133376" {
+			t.Fatalf("expected %s to path to have id 2000133376, got %q", version, id)
+		}
+	}
+
+	fmVersion, _ := LookupFMVersion("2024")
+	if _, ok := fmVersion.PlayerID("graphics/pictures/person/2000133376/portrait"); ok {
+		t.Fatal("expected a to path without the r- prefix not to be a 2024 portrait")
+	}
+}
+
+func TestFMVersion_ClassifyRecord(t *testing.T) {
+	fmVersion, _ := LookupFMVersion("2024")
+
+	cases := map[string]RecordKind{
+		"graphics/pictures/person/r-2000133376/portrait": RecordFace,
+		"graphics/pictures/person/2000133376/portrait":   RecordPortrait,
+		"graphics/pictures/person/r-2000133376/kit":      RecordOther,
+		"graphics/pictures/club/12/logo":                 RecordOther,
+		"graphics/pictures/person/r-12/portrait/extra":   RecordOther,
+	}
+
+	for toPath, expected := range cases {
+		if kind := fmVersion.ClassifyRecord(Record{From: "x", To: toPath}); kind != expected {
+			t.Fatalf("expected %q to be kind %d, got %d", toPath, expected, kind)
+		}
+	}
+}